@@ -1,16 +1,25 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/UrsusArctos/dkit/pkg/daemonizer"
 	"github.com/UrsusArctos/dkit/pkg/logmeow"
 )
 
+type TMeowConfig struct {
+	Interval time.Duration `conf:"interval" default:"500ms" env:"MYMEOW_INTERVAL"`
+	Message  string        `conf:"message" default:"Run called"`
+}
+
 type TMeowDaemon struct {
 	LinuxDaemon daemonizer.TLinuxDaemon
 	MeowLogger  logmeow.TLogMeow
+	Config      *TMeowConfig
 }
 
 func (MD TMeowDaemon) MeowInit() (err error) {
@@ -25,18 +34,56 @@ func (MD TMeowDaemon) MeowClose() (err error) {
 	return nil
 }
 
+func (MD TMeowDaemon) MeowReload() (err error) {
+	MD.MeowLogger.LogEventInfo("Reload called")
+	fresh, changed, err := daemonizer.ReloadConfig(MD.LinuxDaemon.ConfFile, daemonizer.TConfigOptions{AllowMissing: true}, MD.Config)
+	if err == nil {
+		*MD.Config = *fresh
+		if len(changed) > 0 {
+			MD.MeowLogger.LogEventInfo(fmt.Sprintf("Config changed: [%s]", strings.Join(changed, ", ")))
+		}
+	}
+	return err
+}
+
 func (MD TMeowDaemon) MeowRun() (err error) {
-	time.Sleep(500 * time.Millisecond)
-	MD.MeowLogger.LogEventInfo("Run called")
+	time.Sleep(MD.Config.Interval)
+	MD.MeowLogger.LogEventInfo(MD.Config.Message)
 	return nil
 }
 
 func main() {
 	md := TMeowDaemon{LinuxDaemon: daemonizer.NewLinuxDaemon("mymeow")}
+	switch flag.Arg(0) {
+	case "status":
+		pid, err := md.LinuxDaemon.Status()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(3)
+		}
+		fmt.Printf("running with pid %d\n", pid)
+		return
+	case "stop":
+		if err := md.LinuxDaemon.Stop(time.Minute); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	config, err := daemonizer.LoadConfig[TMeowConfig](md.LinuxDaemon.ConfFile, daemonizer.TConfigOptions{AllowMissing: true})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	md.Config = config
 	md.MeowLogger = logmeow.NewLogMeow("mymeow", logmeow.FacConsole|logmeow.FacFile, md.LinuxDaemon.LogPath)
 	md.LinuxDaemon.FuncInit = md.MeowInit
 	md.LinuxDaemon.FuncClose = md.MeowClose
 	md.LinuxDaemon.FuncMain = md.MeowRun
+	md.LinuxDaemon.FuncReload = md.MeowReload
+	md.LinuxDaemon.FuncHookError = func(sig os.Signal, err error) {
+		md.MeowLogger.LogEventError(fmt.Sprintf("%s: %v", sig, err))
+	}
 	md.LinuxDaemon.TestFunc()
 	e := md.LinuxDaemon.Run()
 	fmt.Printf("exit %+v\n", e)
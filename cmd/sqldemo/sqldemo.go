@@ -1,61 +1,50 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 
 	"github.com/UrsusArctos/dkit/pkg/aegisql"
 )
 
 const (
-	dNameSQLite3 = "sqlite3"
-	dNameMySQL   = "mysql"
-	//
-	queryCreate_SQLite3 = "CREATE TABLE IF NOT EXISTS [demotable] ([id] INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, [descr] VARCHAR(32) NULL);"
-	queryCreate_MySQL   = "CREATE TABLE IF NOT EXISTS `demotable` (`id` INT(10) NOT NULL AUTO_INCREMENT, `descr` VARCHAR(32) NULL DEFAULT NULL, PRIMARY KEY (`id`));"
-	queryInsertRow      = "INSERT INTO demotable (descr) VALUES ('new description');"
-	querySelectData     = "SELECT * FROM demotable;"
+	dNameSQLite3 = aegisql.DriverSQLite3
+	dNameMySQL   = aegisql.DriverMySQL
 )
 
 var (
 	driverName = [...]string{dNameSQLite3, dNameMySQL}
+	demoTable  = aegisql.NewTable("demotable").AutoID("id").Column("descr", aegisql.KindString, aegisql.Size(32), aegisql.Nullable())
+	//
+	queryInsertRow  = aegisql.Insert("demotable").Columns("descr").Values("new description")
+	querySelectData = aegisql.Select().From("demotable")
 )
 
 func main() {
 	for dn := range driverName {
-		var (
-			driverDSN   string
-			queryCreate string
-		)
+		var driverConf aegisql.TDSNConfig
 		fmt.Printf("%s: ", driverName[dn])
-		// Compose DSN
+		// Compose connection settings
 		switch driverName[dn] {
 		case dNameSQLite3:
-			{
-				driverDSN = aegisql.MakeDSN(driverName[dn], "/storage/shared/workbench/demo.s3db")
-				queryCreate = queryCreate_SQLite3
-			}
+			driverConf = aegisql.TSQLiteConfig{Path: "/storage/shared/workbench/demo.s3db", SharedCache: true}
 		case dNameMySQL:
-			{
-				driverDSN = aegisql.MakeDSN(driverName[dn], "dkituser", "dkitpass", "tcp", "10.0.0.10", "14030", "dkit")
-				queryCreate = queryCreate_MySQL
-			}
+			driverConf = aegisql.TMySQLConfig{User: "dkituser", Password: "dkitpass", Host: "10.0.0.10", Port: 14030, Database: "dkit"}
 		}
 		// Open database
-		dbptr, err := sql.Open(driverName[dn], driverDSN)
+		AeSQL, err := aegisql.OpenConfig(driverConf)
 		if err == nil {
 			fmt.Print("opened,")
-			AeSQL := aegisql.TAegiSQLDB{DB: dbptr}
+			AeSQL.ConfigurePool(aegisql.DefaultPoolConfig(driverName[dn]))
 			// Create table
-			_, err2 := AeSQL.QuerySingle(queryCreate)
+			err2 := AeSQL.CreateTable(demoTable)
 			if err2 == nil {
 				fmt.Print("created,")
 				// Insert some data
-				_, err3 := AeSQL.QuerySingle(queryInsertRow)
+				_, err3 := AeSQL.QuerySingleBuilt(queryInsertRow)
 				if err3 == nil {
 					fmt.Print("inserted,")
 					// Query some data
-					dataRows, err4 := AeSQL.QueryData(querySelectData)
+					dataRows, err4 := AeSQL.QueryDataBuilt(querySelectData)
 					if err4 == nil {
 						fmt.Print("queried,")
 						// Ouput received data
@@ -66,6 +55,7 @@ func main() {
 							}
 							fmt.Printf("data:(%+v)", rowData)
 						}
+						dataRows.Close()
 					} else {
 						fmt.Printf("DB data query error %+v\n", err4)
 						break
@@ -82,7 +72,7 @@ func main() {
 			fmt.Printf("DB open error %+v\n", err)
 			break
 		}
-		dbptr.Close()
+		AeSQL.Close()
 		fmt.Println()
 	}
 }
@@ -1,49 +1,130 @@
 package aegisql
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"time"
 
 	"database/sql"
 
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// Supported drivers
+	DriverSQLite3 = "sqlite3"
+	DriverMySQL   = "mysql"
 )
 
 type (
 	TAegiSQLDB struct {
 		*sql.DB
+		RetryPolicy  TRetryPolicy  // used by WithTx
+		StmtCache    *TStmtCache   // used by QuerySingle when set
+		QueryTimeout time.Duration // applied to every query when positive
+		Hooks        []TQueryHook  // called around every QuerySingle and QueryData
+		Redact       TRedactFunc   // hides arguments from hooks, RedactValues if nil
+		changes      *tChangeHub   // set when SQLite hooks capture changes
 	}
 
 	TAegiSQLRows struct {
 		*sql.Rows
+		cancel context.CancelFunc // releases query timeout
 	}
 
 	TAegiSQLDataRow = map[string]string
+
+	// Row of native Go values, NULL is represented by nil
+	TAegiSQLTypedRow = map[string]any
 )
 
+// Returned by UnloadNextTypedRow when the rows are exhausted
+var ErrNoMoreRows = errors.New("no more rows")
+
+// Deprecated: positional arguments are error-prone, use TSQLiteConfig or TMySQLConfig instead.
+// Returns empty string for unknown driver or too few arguments.
 func MakeDSN(driverName string, arg ...string) string {
 	switch driverName {
-	case "sqlite3":
+	case DriverSQLite3:
 		// arg[0] 	- DB file name
+		if len(arg) < 1 {
+			return ""
+		}
 		return fmt.Sprintf("file:%s?cache=shared&mode=rwc", arg[0])
-	case "mysql":
+	case DriverMySQL:
 		// arg[0]	- username
 		// arg[1]	- password
 		// arg[2]	- protocol (see net.Dial)
 		// arg[3]	- host address
 		// arg[4]	- port
 		// arg[5]	- database name
+		if len(arg) < 6 {
+			return ""
+		}
 		return fmt.Sprintf("%s:%s@%s(%s:%s)/%s", arg[0], arg[1], arg[2], arg[3], arg[4], arg[5])
 	default:
 		return ""
 	}
 }
 
+// Returns name of the driver the database was opened with
+func (sqldb TAegiSQLDB) DriverName() string {
+	switch sqldb.Driver().(type) {
+	case *sqlite3.SQLiteDriver:
+		return DriverSQLite3
+	case *mysql.MySQLDriver:
+		return DriverMySQL
+	default:
+		return ""
+	}
+}
+
+// Closes cached statements, if any, and the database
+func (sqldb TAegiSQLDB) Close() error {
+	if sqldb.StmtCache != nil {
+		sqldb.StmtCache.Purge()
+	}
+	return sqldb.DB.Close()
+}
+
+// Derives context limited by QueryTimeout, if set
+func (sqldb TAegiSQLDB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if sqldb.QueryTimeout > 0 {
+		return context.WithTimeout(ctx, sqldb.QueryTimeout)
+	}
+	return ctx, func() {}
+}
+
 func (sqldb TAegiSQLDB) QuerySingle(query string, args ...any) (sql.Result, error) {
-	stmt, perr := sqldb.Prepare(query)
+	return sqldb.QuerySingleCtx(context.Background(), query, args...)
+}
+
+func (sqldb TAegiSQLDB) QuerySingleCtx(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	finish := sqldb.trace(ctx, QueryExec, query, args)
+	res, err := sqldb.exec(ctx, query, args...)
+	finish(res, err)
+	return res, err
+}
+
+func (sqldb TAegiSQLDB) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, cancel := sqldb.withTimeout(ctx)
+	defer cancel()
+	if sqldb.StmtCache != nil {
+		stmt, release, perr := sqldb.StmtCache.acquire(ctx, sqldb.DB, query)
+		if perr == nil {
+			res, eerr := stmt.ExecContext(ctx, args...)
+			release(eerr)
+			return res, eerr
+		}
+		return nil, perr
+	}
+	stmt, perr := sqldb.PrepareContext(ctx, query)
 	if perr == nil {
 		defer stmt.Close()
-		res, eerr := stmt.Exec(args...)
+		res, eerr := stmt.ExecContext(ctx, args...)
 		if eerr == nil {
 			return res, eerr
 		}
@@ -53,27 +134,66 @@ func (sqldb TAegiSQLDB) QuerySingle(query string, args ...any) (sql.Result, erro
 }
 
 func (sqldb TAegiSQLDB) QueryData(query string, args ...any) (TAegiSQLRows, error) {
-	rawRows, err := sqldb.Query(query, args...)
+	return sqldb.QueryDataCtx(context.Background(), query, args...)
+}
+
+// Runs a query; cancelling ctx (or hitting QueryTimeout) aborts the query and closes the rows.
+// Hooks see the time until the first row is ready, not until the rows are read.
+func (sqldb TAegiSQLDB) QueryDataCtx(ctx context.Context, query string, args ...any) (TAegiSQLRows, error) {
+	finish := sqldb.trace(ctx, QueryRows, query, args)
+	ctx, cancel := sqldb.withTimeout(ctx)
+	rawRows, err := sqldb.QueryContext(ctx, query, args...)
+	finish(nil, err)
 	if err == nil {
-		return TAegiSQLRows{rawRows}, nil
+		return TAegiSQLRows{Rows: rawRows, cancel: cancel}, nil
 	}
+	cancel()
 	return TAegiSQLRows{}, err
 }
 
-func (rows TAegiSQLRows) UnloadNextRow() TAegiSQLDataRow {
+// Closes the rows and releases query timeout
+func (rows TAegiSQLRows) Close() error {
+	err := rows.Rows.Close()
+	if rows.cancel != nil {
+		rows.cancel()
+	}
+	return err
+}
+
+// Moves to the next row, returns ErrNoMoreRows at the end and closes rows once ctx is done
+func (rows TAegiSQLRows) advance(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		rows.Close()
+		return err
+	}
 	if rows.Next() {
+		return nil
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return ErrNoMoreRows
+}
+
+func (rows TAegiSQLRows) UnloadNextRow() TAegiSQLDataRow {
+	return rows.UnloadNextRowCtx(context.Background())
+}
+
+func (rows TAegiSQLRows) UnloadNextRowCtx(ctx context.Context) TAegiSQLDataRow {
+	if rows.advance(ctx) == nil {
 		columns, cerr := rows.Columns()
 		if cerr == nil {
 			pointers := make([]any, len(columns))
-			values := make([]string, len(columns))
+			values := make([]sql.NullString, len(columns))
 			for i := range pointers {
 				pointers[i] = &values[i]
 			}
 			scanerr := rows.Scan(pointers...)
 			if scanerr == nil {
+				// NULL turns into empty string here, use UnloadNextTypedRow to tell them apart
 				result := make(TAegiSQLDataRow)
 				for i := range values {
-					result[columns[i]] = values[i]
+					result[columns[i]] = values[i].String
 				}
 				return result
 			}
@@ -81,3 +201,73 @@ func (rows TAegiSQLRows) UnloadNextRow() TAegiSQLDataRow {
 	}
 	return nil
 }
+
+// Returns next row with values converted to native types of their columns. Dates come as time.Time,
+// or as string when the driver leaves them unparsed (MySQL without parseTime=true).
+// At the end of rows the error is ErrNoMoreRows, any other error means failure.
+func (rows TAegiSQLRows) UnloadNextTypedRow() (TAegiSQLTypedRow, error) {
+	return rows.UnloadNextTypedRowCtx(context.Background())
+}
+
+func (rows TAegiSQLRows) UnloadNextTypedRowCtx(ctx context.Context) (TAegiSQLTypedRow, error) {
+	err := rows.advance(ctx)
+	if err == nil {
+		coltypes, cerr := rows.ColumnTypes()
+		if cerr == nil {
+			pointers := make([]any, len(coltypes))
+			textual := make([]bool, len(coltypes))
+			for i := range coltypes {
+				nt := nativeType(coltypes[i])
+				if nt == timeType {
+					// MySQL delivers dates as text unless the DSN has parseTime=true, so take what comes
+					nt, textual[i] = anyType, true
+				}
+				pointers[i] = reflect.New(reflect.PointerTo(nt)).Interface()
+			}
+			scanerr := rows.Scan(pointers...)
+			if scanerr == nil {
+				result := make(TAegiSQLTypedRow, len(coltypes))
+				for i := range coltypes {
+					// pointer to pointer is set to nil by database/sql on NULL
+					value := reflect.ValueOf(pointers[i]).Elem()
+					if value.IsNil() {
+						result[coltypes[i].Name()] = nil
+					} else if raw, ok := value.Elem().Interface().([]byte); ok && textual[i] {
+						result[coltypes[i].Name()] = string(raw)
+					} else {
+						result[coltypes[i].Name()] = value.Elem().Interface()
+					}
+				}
+				return result, nil
+			}
+			return nil, scanerr
+		}
+		return nil, cerr
+	}
+	return nil, err
+}
+
+var (
+	anyType  = reflect.TypeOf((*any)(nil)).Elem()
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// Returns Go type to hold values of the column, with sql.Null* wrappers removed
+func nativeType(ct *sql.ColumnType) reflect.Type {
+	st := ct.ScanType()
+	switch {
+	case st == nil:
+		return anyType
+	case st == reflect.TypeOf(sql.RawBytes{}):
+		return reflect.TypeOf([]byte{})
+	case st.Kind() == reflect.Pointer || st.Kind() == reflect.Interface:
+		// drivers report unknown types this way
+		return anyType
+	case st.Kind() == reflect.Struct:
+		// sql.NullInt64, sql.NullString, sql.Null[T] etc. keep the value in the first field
+		if valid, ok := st.FieldByName("Valid"); ok && valid.Type.Kind() == reflect.Bool && st.NumField() == 2 {
+			return st.Field(0).Type
+		}
+	}
+	return st
+}
@@ -0,0 +1,432 @@
+package aegisql
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// SQLite backup defaults
+	defPagesPerStep = 256
+	defStepPause    = 5 * time.Millisecond
+	// MySQL dump tuning
+	dumpRowsPerInsert = 100
+	// Backup file permissions
+	backupFileMode = 0600
+)
+
+type (
+	// Settings of Backup and Restore
+	TBackupOptions struct {
+		Gzip         bool          // compress the backup (Restore detects compression by itself)
+		PagesPerStep int           // SQLite pages copied at once, defaults to 256
+		StepPause    time.Duration // SQLite pause between steps to let writers in, defaults to 5ms
+	}
+)
+
+// gzip magic bytes
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func (opts TBackupOptions) withDefaults() TBackupOptions {
+	if opts.PagesPerStep <= 0 {
+		opts.PagesPerStep = defPagesPerStep
+	}
+	if opts.StepPause <= 0 {
+		opts.StepPause = defStepPause
+	}
+	return opts
+}
+
+// Writes a snapshot of the database to destPath: SQLite database file made with the online backup API,
+// or a logical dump (schema and INSERTs) for MySQL. The file is replaced atomically.
+func (sqldb TAegiSQLDB) Backup(ctx context.Context, destPath string, opts TBackupOptions) error {
+	opts = opts.withDefaults()
+	tmp, err := os.CreateTemp(filepath.Dir(destPath), filepath.Base(destPath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	switch sqldb.DriverName() {
+	case DriverSQLite3:
+		tmp.Close()
+		if err = sqldb.backupSQLite(ctx, tmpPath, opts); err == nil && opts.Gzip {
+			err = gzipFile(tmpPath)
+		}
+	case DriverMySQL:
+		err = writeMaybeGzip(tmp, opts.Gzip, func(w io.Writer) error {
+			return sqldb.dumpMySQL(ctx, w)
+		})
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+	default:
+		tmp.Close()
+		err = fmt.Errorf("backup is not supported for driver %q", sqldb.DriverName())
+	}
+	if err == nil {
+		if err = os.Chmod(tmpPath, backupFileMode); err == nil {
+			return os.Rename(tmpPath, destPath)
+		}
+	}
+	return err
+}
+
+// Loads a snapshot made by Backup, replacing the database contents
+func (sqldb TAegiSQLDB) Restore(ctx context.Context, srcPath string, opts TBackupOptions) error {
+	opts = opts.withDefaults()
+	src, err := openMaybeGzip(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	switch sqldb.DriverName() {
+	case DriverSQLite3:
+		// the backup API needs a database file, so compressed snapshots get unpacked first
+		plainPath := srcPath
+		if src.compressed {
+			tmp, terr := os.CreateTemp("", "aegisql-restore-*")
+			if terr != nil {
+				return terr
+			}
+			defer os.Remove(tmp.Name())
+			_, err = io.Copy(tmp, src)
+			if cerr := tmp.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+			plainPath = tmp.Name()
+		}
+		return sqldb.restoreSQLite(ctx, plainPath, opts)
+	case DriverMySQL:
+		return sqldb.restoreMySQL(ctx, src)
+	default:
+		return fmt.Errorf("restore is not supported for driver %q", sqldb.DriverName())
+	}
+}
+
+// SQLITE
+
+// Copies pages from src to dest connection step by step, so that writers are not blocked for long
+func copyPages(ctx context.Context, dest *sqlite3.SQLiteConn, src *sqlite3.SQLiteConn, opts TBackupOptions) error {
+	bk, err := dest.Backup("main", src, "main")
+	if err != nil {
+		return err
+	}
+	for {
+		done, serr := bk.Step(opts.PagesPerStep)
+		if serr != nil {
+			bk.Finish()
+			return serr
+		}
+		if done {
+			return bk.Finish()
+		}
+		select {
+		case <-ctx.Done():
+			bk.Finish()
+			return ctx.Err()
+		case <-time.After(opts.StepPause):
+		}
+	}
+}
+
+// Runs fn with raw driver connections of two databases
+func withRawConns(ctx context.Context, dest *sql.DB, src *sql.DB, fn func(dest *sqlite3.SQLiteConn, src *sqlite3.SQLiteConn) error) error {
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	return destConn.Raw(func(dc any) error {
+		return srcConn.Raw(func(sc any) error {
+			destLite, dok := dc.(*sqlite3.SQLiteConn)
+			srcLite, sok := sc.(*sqlite3.SQLiteConn)
+			if !dok || !sok {
+				return errors.New("not a sqlite3 connection")
+			}
+			return fn(destLite, srcLite)
+		})
+	})
+}
+
+func (sqldb TAegiSQLDB) backupSQLite(ctx context.Context, destPath string, opts TBackupOptions) error {
+	dsn, err := TSQLiteConfig{Path: destPath}.DSN()
+	if err != nil {
+		return err
+	}
+	dest, err := sql.Open(DriverSQLite3, dsn)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+	err = withRawConns(ctx, dest, sqldb.DB, func(d *sqlite3.SQLiteConn, s *sqlite3.SQLiteConn) error {
+		return copyPages(ctx, d, s, opts)
+	})
+	if err == nil {
+		// WAL mode is copied along with the pages, while a snapshot should be a single self-contained file
+		_, err = dest.ExecContext(ctx, "PRAGMA journal_mode = DELETE")
+	}
+	return err
+}
+
+func (sqldb TAegiSQLDB) restoreSQLite(ctx context.Context, srcPath string, opts TBackupOptions) error {
+	dsn, err := TSQLiteConfig{Path: srcPath, ReadOnly: true}.DSN()
+	if err != nil {
+		return err
+	}
+	src, err := sql.Open(DriverSQLite3, dsn)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return withRawConns(ctx, sqldb.DB, src, func(d *sqlite3.SQLiteConn, s *sqlite3.SQLiteConn) error {
+		return copyPages(ctx, d, s, opts)
+	})
+}
+
+// MYSQL
+
+// Writes schema and data of all base tables as SQL statements, from a single consistent snapshot
+func (sqldb TAegiSQLDB) dumpMySQL(ctx context.Context, w io.Writer) error {
+	d := TMySQLDialect{}
+	conn, err := sqldb.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	tables, err := listMySQLTables(ctx, tx)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "-- aegisql dump %s\nSET NAMES utf8mb4;\nSET FOREIGN_KEY_CHECKS = 0;\n", time.Now().Format(time.RFC3339))
+	for _, table := range tables {
+		var name, create string
+		if err = tx.QueryRowContext(ctx, "SHOW CREATE TABLE "+d.QuoteIdent(table)).Scan(&name, &create); err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "\nDROP TABLE IF EXISTS %s;\n%s;\n", d.QuoteIdent(table), create)
+		if err = dumpMySQLRows(ctx, tx, bw, d, table); err != nil {
+			return err
+		}
+	}
+	fmt.Fprint(bw, "\nSET FOREIGN_KEY_CHECKS = 1;\n")
+	return bw.Flush()
+}
+
+func listMySQLTables(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "SHOW FULL TABLES WHERE Table_type = 'BASE TABLE'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := make([]string, 0)
+	for rows.Next() {
+		var name, kind string
+		if err = rows.Scan(&name, &kind); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+func dumpMySQLRows(ctx context.Context, tx *sql.Tx, w io.Writer, d TDialect, table string) error {
+	rawRows, err := tx.QueryContext(ctx, "SELECT * FROM "+d.QuoteIdent(table))
+	if err != nil {
+		return err
+	}
+	rows := TAegiSQLRows{Rows: rawRows}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	head := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", d.QuoteIdent(table), quoteList(d, columns))
+	pending := 0
+	for {
+		row, uerr := rows.UnloadNextTypedRowCtx(ctx)
+		if errors.Is(uerr, ErrNoMoreRows) {
+			break
+		}
+		if uerr != nil {
+			return uerr
+		}
+		literals := make([]string, len(columns))
+		for i, column := range columns {
+			literals[i] = sqlLiteral(row[column])
+		}
+		if pending == 0 {
+			io.WriteString(w, head)
+		} else {
+			io.WriteString(w, ",\n")
+		}
+		io.WriteString(w, "("+strings.Join(literals, ", ")+")")
+		if pending++; pending == dumpRowsPerInsert {
+			io.WriteString(w, ";\n")
+			pending = 0
+		}
+	}
+	if pending > 0 {
+		io.WriteString(w, ";\n")
+	}
+	return nil
+}
+
+// Renders value as MySQL literal without backslash escapes, so it reads the same under any sql_mode
+func sqlLiteral(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int, int8, int16, int32, uint, uint8, uint16, uint32, uint64, float32:
+		return fmt.Sprint(v)
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return "NULL"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
+	case []byte:
+		return hexLiteral(v)
+	case string:
+		if !utf8.ValidString(v) || strings.ContainsAny(v, "\\\x00\x1a") {
+			return hexLiteral([]byte(v))
+		}
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return sqlLiteral(fmt.Sprint(v))
+	}
+}
+
+func hexLiteral(b []byte) string {
+	if len(b) == 0 {
+		return "''"
+	}
+	return "X'" + hex.EncodeToString(b) + "'"
+}
+
+func (sqldb TAegiSQLDB) restoreMySQL(ctx context.Context, r io.Reader) error {
+	// session settings of the dump must apply to all its statements
+	conn, err := sqldb.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return ScanDialectStatements(TMySQLDialect{}, r, func(stmt string) error {
+		_, eerr := conn.ExecContext(ctx, stmt)
+		return eerr
+	})
+}
+
+// FILES
+
+type tBackupReader struct {
+	io.Reader
+	compressed bool
+	closers    []io.Closer
+}
+
+func (br *tBackupReader) Close() error {
+	var errs []error
+	for i := len(br.closers) - 1; i >= 0; i-- {
+		errs = append(errs, br.closers[i].Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Opens a file, transparently decompressing it if it is gzipped
+func openMaybeGzip(path string) (*tBackupReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := &tBackupReader{closers: []io.Closer{f}}
+	buffered := bufio.NewReader(f)
+	magic, _ := buffered.Peek(len(gzipMagic))
+	if string(magic) == string(gzipMagic) {
+		gz, gerr := gzip.NewReader(buffered)
+		if gerr != nil {
+			f.Close()
+			return nil, gerr
+		}
+		br.Reader = gz
+		br.compressed = true
+		br.closers = append(br.closers, gz)
+	} else {
+		br.Reader = buffered
+	}
+	return br, nil
+}
+
+func writeMaybeGzip(w io.Writer, compress bool, fn func(w io.Writer) error) error {
+	if !compress {
+		return fn(w)
+	}
+	gz := gzip.NewWriter(w)
+	if err := fn(gz); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+// Compresses file in place
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dest, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path + ".gz")
+	err = writeMaybeGzip(dest, true, func(w io.Writer) error {
+		_, cerr := io.Copy(w, src)
+		return cerr
+	})
+	if cerr := dest.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		return os.Rename(path+".gz", path)
+	}
+	return err
+}
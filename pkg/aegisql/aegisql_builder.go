@@ -0,0 +1,508 @@
+package aegisql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type (
+	// Anything that renders into SQL text with bound arguments
+	TSQLBuilder interface {
+		Build(d TDialect) (string, []any, error)
+	}
+
+	// Condition of a WHERE clause
+	TCond interface {
+		render(args *tSQLArgs) string
+	}
+
+	// Collects bound arguments, numbering placeholders as it goes
+	tSQLArgs struct {
+		dialect TDialect
+		values  []any
+		err     error // first rendering error
+	}
+
+	tCompare struct {
+		column string
+		op     string
+		value  any
+	}
+
+	tIn struct {
+		column string
+		values []any
+		negate bool
+	}
+
+	tNullCheck struct {
+		column string
+		isNull bool
+	}
+
+	tJunction struct {
+		op    string
+		conds []TCond
+	}
+
+	tNot struct {
+		cond TCond
+	}
+
+	tRaw struct {
+		expr string
+		args []any
+	}
+
+	tOrder struct {
+		column string
+		desc   bool
+	}
+
+	// Column of a SELECT list, either a name or an expression
+	tSelectColumn struct {
+		name string
+		expr *tRaw
+	}
+
+	TSelectQuery struct {
+		columns []tSelectColumn
+		table   string
+		where   []TCond
+		groupBy []string
+		orderBy []tOrder
+		limit   int64
+		offset  int64
+	}
+
+	TInsertQuery struct {
+		table   string
+		columns []string
+		rows    [][]any
+	}
+
+	TUpdateQuery struct {
+		table   string
+		columns []string
+		values  []any
+		where   []TCond
+	}
+
+	TDeleteQuery struct {
+		table string
+		where []TCond
+	}
+)
+
+var (
+	// Returned by Update and Delete without conditions
+	ErrNoWhere = errors.New("statement affects all rows, use Where(All()) if intended")
+)
+
+func (args *tSQLArgs) bind(value any) string {
+	args.values = append(args.values, value)
+	return args.dialect.Placeholder(len(args.values))
+}
+
+func (args *tSQLArgs) fail(err error) {
+	if args.err == nil {
+		args.err = err
+	}
+}
+
+// Quotes every part of a dotted name, so that anything but "*" ends up an identifier;
+// expressions have to go through Expr
+func quoteColumn(d TDialect, column string) string {
+	parts := strings.Split(column, ".")
+	for i := range parts {
+		if parts[i] != "*" || i < len(parts)-1 {
+			parts[i] = d.QuoteIdent(parts[i])
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func renderWhere(conds []TCond, args *tSQLArgs) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + And(conds...).render(args)
+}
+
+// CONDITIONS
+
+func Eq(column string, value any) TCond {
+	if value == nil {
+		return IsNull(column)
+	}
+	return tCompare{column, "=", value}
+}
+
+func Ne(column string, value any) TCond {
+	if value == nil {
+		return NotNull(column)
+	}
+	return tCompare{column, "<>", value}
+}
+
+func Lt(column string, value any) TCond {
+	return tCompare{column, "<", value}
+}
+
+func Le(column string, value any) TCond {
+	return tCompare{column, "<=", value}
+}
+
+func Gt(column string, value any) TCond {
+	return tCompare{column, ">", value}
+}
+
+func Ge(column string, value any) TCond {
+	return tCompare{column, ">=", value}
+}
+
+func Like(column string, pattern string) TCond {
+	return tCompare{column, "LIKE", pattern}
+}
+
+func In(column string, values ...any) TCond {
+	return tIn{column: column, values: values}
+}
+
+func NotIn(column string, values ...any) TCond {
+	return tIn{column: column, values: values, negate: true}
+}
+
+func IsNull(column string) TCond {
+	return tNullCheck{column, true}
+}
+
+func NotNull(column string) TCond {
+	return tNullCheck{column, false}
+}
+
+func And(conds ...TCond) TCond {
+	return tJunction{"AND", conds}
+}
+
+func Or(conds ...TCond) TCond {
+	return tJunction{"OR", conds}
+}
+
+func Not(cond TCond) TCond {
+	return tNot{cond}
+}
+
+// Matches every row
+func All() TCond {
+	return tRaw{expr: "1 = 1"}
+}
+
+// Raw SQL condition with "?" placeholders
+func Expr(expr string, args ...any) TCond {
+	return tRaw{expr, args}
+}
+
+func (c tCompare) render(args *tSQLArgs) string {
+	return fmt.Sprintf("%s %s %s", quoteColumn(args.dialect, c.column), c.op, args.bind(c.value))
+}
+
+func (c tIn) render(args *tSQLArgs) string {
+	if len(c.values) == 0 {
+		// empty set matches nothing, or everything when negated
+		if c.negate {
+			return "1 = 1"
+		}
+		return "1 = 0"
+	}
+	ph := make([]string, len(c.values))
+	for i := range c.values {
+		ph[i] = args.bind(c.values[i])
+	}
+	op := "IN"
+	if c.negate {
+		op = "NOT IN"
+	}
+	return fmt.Sprintf("%s %s (%s)", quoteColumn(args.dialect, c.column), op, strings.Join(ph, ", "))
+}
+
+func (c tNullCheck) render(args *tSQLArgs) string {
+	if c.isNull {
+		return quoteColumn(args.dialect, c.column) + " IS NULL"
+	}
+	return quoteColumn(args.dialect, c.column) + " IS NOT NULL"
+}
+
+func (c tJunction) render(args *tSQLArgs) string {
+	switch len(c.conds) {
+	case 0:
+		// neutral element: nothing to satisfy, or nothing to choose from
+		if c.op == "AND" {
+			return "1 = 1"
+		}
+		return "1 = 0"
+	case 1:
+		return c.conds[0].render(args)
+	}
+	parts := make([]string, len(c.conds))
+	for i := range c.conds {
+		parts[i] = "(" + c.conds[i].render(args) + ")"
+	}
+	return strings.Join(parts, " "+c.op+" ")
+}
+
+func (c tNot) render(args *tSQLArgs) string {
+	return "NOT (" + c.cond.render(args) + ")"
+}
+
+func (c tRaw) render(args *tSQLArgs) string {
+	// renumber placeholders for dialects that need it
+	parts := strings.Split(c.expr, "?")
+	if len(parts)-1 != len(c.args) {
+		args.fail(fmt.Errorf("expression %q has %d placeholders for %d arguments", c.expr, len(parts)-1, len(c.args)))
+		return c.expr
+	}
+	var sb strings.Builder
+	for i, part := range parts {
+		sb.WriteString(part)
+		if i < len(parts)-1 {
+			sb.WriteString(args.bind(c.args[i]))
+		}
+	}
+	return sb.String()
+}
+
+// SELECT
+
+func Select(columns ...string) *TSelectQuery {
+	q := &TSelectQuery{limit: -1}
+	for _, column := range columns {
+		q.columns = append(q.columns, tSelectColumn{name: column})
+	}
+	return q
+}
+
+// Adds an expression like "COUNT(*) AS n" to the SELECT list, with "?" placeholders
+func (q *TSelectQuery) ColumnExpr(expr string, args ...any) *TSelectQuery {
+	q.columns = append(q.columns, tSelectColumn{expr: &tRaw{expr, args}})
+	return q
+}
+
+func (q *TSelectQuery) From(table string) *TSelectQuery {
+	q.table = table
+	return q
+}
+
+// Adds conditions, all of them must hold
+func (q *TSelectQuery) Where(conds ...TCond) *TSelectQuery {
+	q.where = append(q.where, conds...)
+	return q
+}
+
+func (q *TSelectQuery) GroupBy(columns ...string) *TSelectQuery {
+	q.groupBy = append(q.groupBy, columns...)
+	return q
+}
+
+func (q *TSelectQuery) OrderBy(columns ...string) *TSelectQuery {
+	for _, column := range columns {
+		q.orderBy = append(q.orderBy, tOrder{column: column})
+	}
+	return q
+}
+
+func (q *TSelectQuery) OrderByDesc(columns ...string) *TSelectQuery {
+	for _, column := range columns {
+		q.orderBy = append(q.orderBy, tOrder{column: column, desc: true})
+	}
+	return q
+}
+
+func (q *TSelectQuery) Limit(limit int64) *TSelectQuery {
+	q.limit = limit
+	return q
+}
+
+func (q *TSelectQuery) Offset(offset int64) *TSelectQuery {
+	q.offset = offset
+	return q
+}
+
+func (q *TSelectQuery) Build(d TDialect) (string, []any, error) {
+	if q.table == "" {
+		return "", nil, errors.New("SELECT without FROM")
+	}
+	args := &tSQLArgs{dialect: d}
+	columns := "*"
+	if len(q.columns) > 0 {
+		quoted := make([]string, len(q.columns))
+		for i, column := range q.columns {
+			if column.expr != nil {
+				quoted[i] = column.expr.render(args)
+			} else {
+				quoted[i] = quoteColumn(d, column.name)
+			}
+		}
+		columns = strings.Join(quoted, ", ")
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SELECT %s FROM %s", columns, quoteColumn(d, q.table))
+	sb.WriteString(renderWhere(q.where, args))
+	if len(q.groupBy) > 0 {
+		quoted := make([]string, len(q.groupBy))
+		for i := range q.groupBy {
+			quoted[i] = quoteColumn(d, q.groupBy[i])
+		}
+		sb.WriteString(" GROUP BY " + strings.Join(quoted, ", "))
+	}
+	if len(q.orderBy) > 0 {
+		orders := make([]string, len(q.orderBy))
+		for i, order := range q.orderBy {
+			orders[i] = quoteColumn(d, order.column)
+			if order.desc {
+				orders[i] += " DESC"
+			}
+		}
+		sb.WriteString(" ORDER BY " + strings.Join(orders, ", "))
+	}
+	if lo := d.LimitOffset(q.limit, q.offset); lo != "" {
+		sb.WriteString(" " + lo)
+	}
+	if args.err != nil {
+		return "", nil, args.err
+	}
+	return sb.String(), args.values, nil
+}
+
+// INSERT
+
+func Insert(table string) *TInsertQuery {
+	return &TInsertQuery{table: table}
+}
+
+func (q *TInsertQuery) Columns(columns ...string) *TInsertQuery {
+	q.columns = columns
+	return q
+}
+
+// Adds a row of values, in the order of Columns
+func (q *TInsertQuery) Values(values ...any) *TInsertQuery {
+	q.rows = append(q.rows, values)
+	return q
+}
+
+func (q *TInsertQuery) Build(d TDialect) (string, []any, error) {
+	if len(q.columns) == 0 || len(q.rows) == 0 {
+		return "", nil, errors.New("INSERT without columns or values")
+	}
+	args := &tSQLArgs{dialect: d}
+	tuples := make([]string, len(q.rows))
+	for r, row := range q.rows {
+		if len(row) != len(q.columns) {
+			return "", nil, fmt.Errorf("INSERT row %d has %d values for %d columns", r, len(row), len(q.columns))
+		}
+		ph := make([]string, len(row))
+		for i := range row {
+			ph[i] = args.bind(row[i])
+		}
+		tuples[r] = "(" + strings.Join(ph, ", ") + ")"
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", quoteColumn(d, q.table), quoteList(d, q.columns), strings.Join(tuples, ", ")), args.values, nil
+}
+
+// UPDATE
+
+func Update(table string) *TUpdateQuery {
+	return &TUpdateQuery{table: table}
+}
+
+func (q *TUpdateQuery) Set(column string, value any) *TUpdateQuery {
+	q.columns = append(q.columns, column)
+	q.values = append(q.values, value)
+	return q
+}
+
+// Adds conditions, all of them must hold
+func (q *TUpdateQuery) Where(conds ...TCond) *TUpdateQuery {
+	q.where = append(q.where, conds...)
+	return q
+}
+
+func (q *TUpdateQuery) Build(d TDialect) (string, []any, error) {
+	if len(q.columns) == 0 {
+		return "", nil, errors.New("UPDATE without SET")
+	}
+	if len(q.where) == 0 {
+		return "", nil, ErrNoWhere
+	}
+	args := &tSQLArgs{dialect: d}
+	set := make([]string, len(q.columns))
+	for i := range q.columns {
+		set[i] = fmt.Sprintf("%s = %s", d.QuoteIdent(q.columns[i]), args.bind(q.values[i]))
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s%s", quoteColumn(d, q.table), strings.Join(set, ", "), renderWhere(q.where, args))
+	if args.err != nil {
+		return "", nil, args.err
+	}
+	return query, args.values, nil
+}
+
+// DELETE
+
+func Delete(table string) *TDeleteQuery {
+	return &TDeleteQuery{table: table}
+}
+
+// Adds conditions, all of them must hold
+func (q *TDeleteQuery) Where(conds ...TCond) *TDeleteQuery {
+	q.where = append(q.where, conds...)
+	return q
+}
+
+func (q *TDeleteQuery) Build(d TDialect) (string, []any, error) {
+	if len(q.where) == 0 {
+		return "", nil, ErrNoWhere
+	}
+	args := &tSQLArgs{dialect: d}
+	query := fmt.Sprintf("DELETE FROM %s%s", quoteColumn(d, q.table), renderWhere(q.where, args))
+	if args.err != nil {
+		return "", nil, args.err
+	}
+	return query, args.values, nil
+}
+
+// Renders the builder in the dialect of the database
+func (sqldb TAegiSQLDB) Build(b TSQLBuilder) (string, []any, error) {
+	d, err := sqldb.Dialect()
+	if err == nil {
+		return b.Build(d)
+	}
+	return "", nil, err
+}
+
+func (sqldb TAegiSQLDB) QuerySingleBuilt(b TSQLBuilder) (sql.Result, error) {
+	return sqldb.QuerySingleBuiltCtx(context.Background(), b)
+}
+
+func (sqldb TAegiSQLDB) QuerySingleBuiltCtx(ctx context.Context, b TSQLBuilder) (sql.Result, error) {
+	query, args, err := sqldb.Build(b)
+	if err == nil {
+		return sqldb.QuerySingleCtx(ctx, query, args...)
+	}
+	return nil, err
+}
+
+func (sqldb TAegiSQLDB) QueryDataBuilt(b TSQLBuilder) (TAegiSQLRows, error) {
+	return sqldb.QueryDataBuiltCtx(context.Background(), b)
+}
+
+func (sqldb TAegiSQLDB) QueryDataBuiltCtx(ctx context.Context, b TSQLBuilder) (TAegiSQLRows, error) {
+	query, args, err := sqldb.Build(b)
+	if err == nil {
+		return sqldb.QueryDataCtx(ctx, query, args...)
+	}
+	return TAegiSQLRows{}, err
+}
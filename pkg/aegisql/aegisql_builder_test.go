@@ -0,0 +1,77 @@
+package aegisql_test
+
+import (
+	"testing"
+
+	"github.com/UrsusArctos/dkit/pkg/aegisql"
+	"github.com/UrsusArctos/dkit/pkg/aegisql/aegisqltest"
+)
+
+func TestBuildQuotesEveryIdentifier(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		b    aegisql.TSQLBuilder
+		want string
+	}{
+		{"plain", aegisql.Select("id", "t.name").From("t"), `SELECT "id", "t"."name" FROM "t"`},
+		{"star", aegisql.Select("t.*").From("main.t"), `SELECT "t".* FROM "main"."t"`},
+		{"condition", aegisql.Select().From("t").Where(aegisql.Eq("id = 1 OR 1", 5)), `SELECT * FROM "t" WHERE "id = 1 OR 1" = ?`},
+		{"order", aegisql.Select().From("t").OrderBy("id; DROP TABLE t"), `SELECT * FROM "t" ORDER BY "id; DROP TABLE t"`},
+		{"quote", aegisql.Select(`a"b`).From("t"), `SELECT "a""b" FROM "t"`},
+		{"expression", aegisql.Select("kind").ColumnExpr("COUNT(*) + ? AS n", 1).From("t").GroupBy("kind"), `SELECT "kind", COUNT(*) + ? AS n FROM "t" GROUP BY "kind"`},
+		{"empty and", aegisql.Select().From("t").Where(aegisql.And()), `SELECT * FROM "t" WHERE 1 = 1`},
+		{"empty or", aegisql.Delete("t").Where(aegisql.Or()), `DELETE FROM "t" WHERE 1 = 0`},
+		{"nested empty", aegisql.Select().From("t").Where(aegisql.Eq("a", 1), aegisql.Or()), `SELECT * FROM "t" WHERE ("a" = ?) AND (1 = 0)`},
+	} {
+		got, _, err := tc.b.Build(aegisql.TSQLiteDialect{})
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		} else if got != tc.want {
+			t.Errorf("%s:\n  want: %s\n  got:  %s", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestBuildChecksExpressionArguments(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		b    aegisql.TSQLBuilder
+	}{
+		{"select", aegisql.Select().From("t").Where(aegisql.Expr("a = ? AND b = ?", 1))},
+		{"column", aegisql.Select().ColumnExpr("? + ?", 1, 2, 3).From("t")},
+		{"update", aegisql.Update("t").Set("a", 1).Where(aegisql.Expr("b = 1", 2))},
+		{"delete", aegisql.Delete("t").Where(aegisql.Not(aegisql.Expr("a = ?")))},
+	} {
+		if query, _, err := tc.b.Build(aegisql.TSQLiteDialect{}); err == nil {
+			t.Errorf("%s: expected error, got %s", tc.name, query)
+		}
+	}
+}
+
+func TestBuiltQueriesRun(t *testing.T) {
+	db := aegisqltest.NewDB(t, aegisqltest.TFixture{Seed: []string{
+		"CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO t (id, name) VALUES (1, 'a'), (2, 'b');",
+	}})
+	count := func(b aegisql.TSQLBuilder) int {
+		t.Helper()
+		query, args, err := db.Build(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		if err = db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+	if n := count(aegisql.Select().ColumnExpr("COUNT(*)").From("t").Where(aegisql.And())); n != 2 {
+		t.Errorf("empty AND matched %d rows, want 2", n)
+	}
+	if n := count(aegisql.Select().ColumnExpr("COUNT(*)").From("t").Where(aegisql.Or())); n != 0 {
+		t.Errorf("empty OR matched %d rows, want 0", n)
+	}
+	// an injected condition stays a single quoted name and cannot widen the match
+	if n := count(aegisql.Select().ColumnExpr("COUNT(*)").From("t").Where(aegisql.Eq("1 = 1 OR id", 5))); n != 0 {
+		t.Errorf("injected condition matched %d rows, want 0", n)
+	}
+}
@@ -0,0 +1,386 @@
+package aegisql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+const (
+	// Rows per INSERT when batch size is not given
+	defBatchSize = 500
+	// Upper limits of bound arguments per statement
+	maxBindVarsSQLite = 32766
+	maxBindVarsMySQL  = 65535
+	// Longest JSONL line accepted by ImportJSONL
+	maxJSONLLine = 16 << 20
+)
+
+type (
+	// Yields rows for BulkInsert, returns io.EOF when exhausted
+	TRowSource func() ([]any, error)
+
+	// Settings of CSV import and export
+	TCSVOptions struct {
+		Comma     rune              // field delimiter, defaults to ','
+		Null      string            // cell text meaning NULL, empty string is not NULL unless set here
+		ColumnMap map[string]string // header -> column; when set, unmapped headers are skipped
+		BatchSize int               // rows per INSERT on import
+	}
+
+	// Settings of JSONL import
+	TJSONLOptions struct {
+		ColumnMap map[string]string // key -> column; when set, unmapped keys are skipped
+		BatchSize int               // rows per INSERT
+	}
+)
+
+// Returns source yielding rows of a slice
+func RowsOf(rows [][]any) TRowSource {
+	next := 0
+	return func() ([]any, error) {
+		if next >= len(rows) {
+			return nil, io.EOF
+		}
+		next++
+		return rows[next-1], nil
+	}
+}
+
+// Caps batch size so that a single INSERT stays within bound argument limit of the dialect
+func effectiveBatchSize(d TDialect, batchSize int, columns int) int {
+	if batchSize <= 0 {
+		batchSize = defBatchSize
+	}
+	limit := maxBindVarsMySQL
+	if d.Name() == DriverSQLite3 {
+		limit = maxBindVarsSQLite
+	}
+	if columns > 0 && batchSize*columns > limit {
+		batchSize = max(limit/columns, 1)
+	}
+	return batchSize
+}
+
+// Inserts all rows from source using multi-row INSERTs of batchSize rows, all in one transaction.
+// Returns number of rows inserted.
+func (sqldb TAegiSQLDB) BulkInsert(ctx context.Context, table string, columns []string, source TRowSource, batchSize int) (int64, error) {
+	d, err := sqldb.Dialect()
+	if err != nil {
+		return 0, err
+	}
+	if len(columns) == 0 {
+		return 0, errors.New("no columns to insert")
+	}
+	batchSize = effectiveBatchSize(d, batchSize, len(columns))
+	var total int64 = 0
+	// the source cannot be replayed, so no retries here
+	err = sqldb.runTx(ctx, nil, func(tx *sql.Tx) error {
+		var fullStmt *sql.Stmt
+		defer func() {
+			if fullStmt != nil {
+				fullStmt.Close()
+			}
+		}()
+		batch := make([][]any, 0, batchSize)
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			q := Insert(table).Columns(columns...)
+			for _, row := range batch {
+				q.Values(row...)
+			}
+			query, args, berr := q.Build(d)
+			if berr != nil {
+				return berr
+			}
+			// full batches share the same text, prepare it once
+			if len(batch) == batchSize {
+				if fullStmt == nil {
+					if fullStmt, berr = tx.PrepareContext(ctx, query); berr != nil {
+						return berr
+					}
+				}
+				_, berr = fullStmt.ExecContext(ctx, args...)
+			} else {
+				_, berr = tx.ExecContext(ctx, query, args...)
+			}
+			if berr == nil {
+				total += int64(len(batch))
+				batch = batch[:0]
+			}
+			return berr
+		}
+		for {
+			row, serr := source()
+			if errors.Is(serr, io.EOF) {
+				return flush()
+			}
+			if serr != nil {
+				return serr
+			}
+			if len(row) != len(columns) {
+				return fmt.Errorf("row %d has %d values for %d columns", total+int64(len(batch)), len(row), len(columns))
+			}
+			batch = append(batch, row)
+			if len(batch) == batchSize {
+				if ferr := flush(); ferr != nil {
+					return ferr
+				}
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// Maps header names onto columns, -1 marks skipped ones
+func mapHeader(header []string, columnMap map[string]string) ([]string, []int) {
+	columns := make([]string, 0, len(header))
+	index := make([]int, len(header))
+	for i, name := range header {
+		column := name
+		if columnMap != nil {
+			mapped, ok := columnMap[name]
+			if !ok {
+				index[i] = -1
+				continue
+			}
+			column = mapped
+		}
+		index[i] = len(columns)
+		columns = append(columns, column)
+	}
+	return columns, index
+}
+
+// Streams CSV with a header row into the table, returns number of rows inserted
+func (sqldb TAegiSQLDB) ImportCSV(ctx context.Context, r io.Reader, table string, opts TCSVOptions) (int64, error) {
+	reader := csv.NewReader(r)
+	if opts.Comma != 0 {
+		reader.Comma = opts.Comma
+	}
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("cannot read CSV header: %w", err)
+	}
+	columns, index := mapHeader(append([]string{}, header...), opts.ColumnMap)
+	source := func() ([]any, error) {
+		record, rerr := reader.Read()
+		if rerr != nil {
+			return nil, rerr
+		}
+		row := make([]any, len(columns))
+		for i, cell := range record {
+			if i < len(index) && index[i] >= 0 {
+				if opts.Null != "" && cell == opts.Null {
+					row[index[i]] = nil
+				} else {
+					row[index[i]] = cell
+				}
+			}
+		}
+		return row, nil
+	}
+	return sqldb.BulkInsert(ctx, table, columns, source, opts.BatchSize)
+}
+
+// Streams query result as CSV with a header row, returns number of rows written
+func (sqldb TAegiSQLDB) ExportCSV(ctx context.Context, w io.Writer, opts TCSVOptions, query string, args ...any) (int64, error) {
+	rows, err := sqldb.QueryDataCtx(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	writer := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		writer.Comma = opts.Comma
+	}
+	if err = writer.Write(columns); err != nil {
+		return 0, err
+	}
+	var count int64 = 0
+	record := make([]string, len(columns))
+	for {
+		row, uerr := rows.UnloadNextTypedRowCtx(ctx)
+		if errors.Is(uerr, ErrNoMoreRows) {
+			break
+		}
+		if uerr != nil {
+			return count, uerr
+		}
+		for i, column := range columns {
+			record[i] = formatCell(row[column], opts.Null)
+		}
+		if werr := writer.Write(record); werr != nil {
+			return count, werr
+		}
+		count++
+	}
+	writer.Flush()
+	return count, writer.Error()
+}
+
+func formatCell(value any, null string) string {
+	switch v := value.(type) {
+	case nil:
+		return null
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Streams JSON Lines (one object per line) into the table, returns number of rows inserted.
+// Columns are taken from keys of the first object, absent keys become NULL.
+func (sqldb TAegiSQLDB) ImportJSONL(ctx context.Context, r io.Reader, table string, opts TJSONLOptions) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLLine)
+	var (
+		columns []string
+		index   map[string]int
+		line    int
+		pending []any
+	)
+	decodeLine := func() (map[string]any, error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			var object map[string]any
+			decoder := json.NewDecoder(bytes.NewReader(text))
+			decoder.UseNumber()
+			if derr := decoder.Decode(&object); derr != nil {
+				return nil, fmt.Errorf("line %d: %w", line, derr)
+			}
+			return object, nil
+		}
+		if serr := scanner.Err(); serr != nil {
+			return nil, serr
+		}
+		return nil, io.EOF
+	}
+	toRow := func(object map[string]any) ([]any, error) {
+		row := make([]any, len(columns))
+		for key, value := range object {
+			column := key
+			if opts.ColumnMap != nil {
+				mapped, ok := opts.ColumnMap[key]
+				if !ok {
+					continue
+				}
+				column = mapped
+			}
+			i, ok := index[column]
+			if !ok {
+				return nil, fmt.Errorf("line %d: key %q is not in the first object", line, key)
+			}
+			converted, cerr := jsonToSQL(value)
+			if cerr != nil {
+				return nil, fmt.Errorf("line %d: key %q: %w", line, key, cerr)
+			}
+			row[i] = converted
+		}
+		return row, nil
+	}
+	// the first object defines the columns
+	first, err := decodeLine()
+	if errors.Is(err, io.EOF) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	keys := make([]string, 0, len(first))
+	for key := range first {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	columns, keyIndex := mapHeader(keys, opts.ColumnMap)
+	index = make(map[string]int)
+	for i := range keys {
+		if keyIndex[i] >= 0 {
+			index[columns[keyIndex[i]]] = keyIndex[i]
+		}
+	}
+	if pending, err = toRow(first); err != nil {
+		return 0, err
+	}
+	source := func() ([]any, error) {
+		if pending != nil {
+			row := pending
+			pending = nil
+			return row, nil
+		}
+		object, derr := decodeLine()
+		if derr != nil {
+			return nil, derr
+		}
+		return toRow(object)
+	}
+	return sqldb.BulkInsert(ctx, table, columns, source, opts.BatchSize)
+}
+
+// Converts decoded JSON value into a bindable argument
+func jsonToSQL(value any) (any, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case map[string]any, []any:
+		// nested values are stored as JSON text
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	default:
+		return v, nil
+	}
+}
+
+// Streams query result as JSON Lines (BLOBs become base64), returns number of rows written
+func (sqldb TAegiSQLDB) ExportJSONL(ctx context.Context, w io.Writer, query string, args ...any) (int64, error) {
+	rows, err := sqldb.QueryDataCtx(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	var count int64 = 0
+	for {
+		row, uerr := rows.UnloadNextTypedRowCtx(ctx)
+		if errors.Is(uerr, ErrNoMoreRows) {
+			break
+		}
+		if uerr != nil {
+			return count, uerr
+		}
+		if eerr := encoder.Encode(row); eerr != nil {
+			return count, eerr
+		}
+		count++
+	}
+	return count, buffered.Flush()
+}
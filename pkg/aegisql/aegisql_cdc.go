@@ -0,0 +1,353 @@
+package aegisql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// Kinds of row changes
+	ChangeInsert TChangeOp = iota
+	ChangeUpdate
+	ChangeDelete
+	ChangeUpsert // reported by polling, which cannot tell inserts from updates
+	// Polling defaults
+	defChangeKeyColumn     = "id"
+	defChangeVersionColumn = "updated_at"
+	defChangePollInterval  = time.Second
+	changePollBatch        = 1000
+)
+
+type (
+	TChangeOp int
+
+	// Single row change
+	TChangeEvent struct {
+		Table   string
+		Op      TChangeOp
+		Key     any       // rowid with hooks, value of the key column with polling
+		Version any       // value of the version column with polling, nil with hooks
+		Time    time.Time // when the change was noticed
+	}
+
+	// Settings of a subscription
+	TChangeOptions struct {
+		Tables        []string        // tables to watch; with hooks, empty means all
+		Poll          bool            // poll even if the database reports changes through hooks
+		KeyColumn     string          // polling: unique key column, defaults to "id"
+		VersionColumn string          // polling: column that grows on every change of a row, defaults to "updated_at"
+		PollInterval  time.Duration   // polling: defaults to 1s
+		OnError       func(err error) // polling: called when a poll fails, polling goes on
+	}
+
+	// Fans out changes reported by SQLite hooks of all connections of a database
+	tChangeHub struct {
+		mu   sync.Mutex
+		subs map[*tChangeSub]struct{}
+	}
+
+	// Unbounded queue of changes of a single subscriber
+	tChangeSub struct {
+		tables map[string]bool
+		mu     sync.Mutex
+		queue  []TChangeEvent
+		signal chan struct{}
+	}
+
+	// Opens connections of a single database through its own driver instance
+	tConnector struct {
+		driver *sqlite3.SQLiteDriver
+		dsn    string
+	}
+
+	// Position of a polling watcher in a table
+	tChangeCursor struct {
+		key     any
+		version any
+	}
+
+	// Polled change along with values as scanned, for the cursor
+	tPolledChange struct {
+		TChangeEvent
+		rawKey     any
+		rawVersion any
+	}
+)
+
+var ErrNoChangeSource = errors.New("database does not capture changes, open it with Capture or poll tables")
+
+func (op TChangeOp) String() string {
+	switch op {
+	case ChangeInsert:
+		return "insert"
+	case ChangeUpdate:
+		return "update"
+	case ChangeDelete:
+		return "delete"
+	case ChangeUpsert:
+		return "upsert"
+	default:
+		return "unknown"
+	}
+}
+
+func (c tConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c tConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Opens SQLite database whose connections report committed row changes to Subscribe
+func openCapturing(dsn string) TAegiSQLDB {
+	hub := &tChangeHub{subs: make(map[*tChangeSub]struct{})}
+	drv := &sqlite3.SQLiteDriver{ConnectHook: hub.attach}
+	return TAegiSQLDB{DB: sql.OpenDB(tConnector{driver: drv, dsn: dsn}), changes: hub}
+}
+
+// Installs hooks on a new connection; changes are held until the transaction commits
+func (hub *tChangeHub) attach(conn *sqlite3.SQLiteConn) error {
+	var pending []TChangeEvent
+	// DELETE without WHERE empties the table at once and skips the update hook,
+	// unless the authorizer answers IGNORE, which makes SQLite delete row by row
+	conn.RegisterAuthorizer(func(action int, _ string, _ string, _ string) int {
+		if action == sqlite3.SQLITE_DELETE {
+			return sqlite3.SQLITE_IGNORE
+		}
+		return sqlite3.SQLITE_OK
+	})
+	conn.RegisterUpdateHook(func(op int, dbName string, table string, rowID int64) {
+		event := TChangeEvent{Table: table, Key: rowID, Time: time.Now()}
+		switch op {
+		case sqlite3.SQLITE_INSERT:
+			event.Op = ChangeInsert
+		case sqlite3.SQLITE_UPDATE:
+			event.Op = ChangeUpdate
+		case sqlite3.SQLITE_DELETE:
+			event.Op = ChangeDelete
+		}
+		pending = append(pending, event)
+	})
+	// SQLite has no hook after a commit, so events go out when it starts; a commit that then fails
+	// (disk full, or SQLITE_BUSY before a retry) has already been reported
+	conn.RegisterCommitHook(func() int {
+		if len(pending) > 0 {
+			hub.publish(pending)
+			pending = nil
+		}
+		// zero lets the commit proceed
+		return 0
+	})
+	conn.RegisterRollbackHook(func() {
+		pending = nil
+	})
+	return nil
+}
+
+func (hub *tChangeHub) publish(events []TChangeEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for sub := range hub.subs {
+		sub.mu.Lock()
+		for _, event := range events {
+			if sub.tables == nil || sub.tables[event.Table] {
+				sub.queue = append(sub.queue, event)
+			}
+		}
+		sub.mu.Unlock()
+		select {
+		case sub.signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (hub *tChangeHub) subscribe(ctx context.Context, tables []string) <-chan TChangeEvent {
+	sub := &tChangeSub{signal: make(chan struct{}, 1)}
+	if len(tables) > 0 {
+		sub.tables = make(map[string]bool)
+		for _, table := range tables {
+			sub.tables[table] = true
+		}
+	}
+	hub.mu.Lock()
+	hub.subs[sub] = struct{}{}
+	hub.mu.Unlock()
+	out := make(chan TChangeEvent)
+	go func() {
+		defer close(out)
+		defer func() {
+			hub.mu.Lock()
+			delete(hub.subs, sub)
+			hub.mu.Unlock()
+		}()
+		for {
+			sub.mu.Lock()
+			batch := sub.queue
+			sub.queue = nil
+			sub.mu.Unlock()
+			for _, event := range batch {
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-sub.signal:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Returns channel of committed row changes, closed once ctx is done.
+// SQLite databases opened with Capture report changes of rows through hooks, as their transactions commit;
+// events are sent when the commit starts, so one that fails at the last moment is reported nevertheless.
+// Rows deleted by DELETE without WHERE are reported one by one, which makes such deletes slower.
+// Changes SQLite makes without hooks are not seen: WITHOUT ROWID tables, REPLACE conflict resolution
+// removing rows, and tables dropped as a whole.
+// Otherwise (or with Poll set) tables are polled for rows with a version column greater than seen before,
+// which misses deletes and rows committed with a smaller version than an already seen one,
+// so an incrementing version counter works better than a timestamp.
+func (sqldb TAegiSQLDB) Subscribe(ctx context.Context, opts TChangeOptions) (<-chan TChangeEvent, error) {
+	if sqldb.changes != nil && !opts.Poll {
+		return sqldb.changes.subscribe(ctx, opts.Tables), nil
+	}
+	if len(opts.Tables) == 0 {
+		return nil, ErrNoChangeSource
+	}
+	return sqldb.pollChanges(ctx, opts)
+}
+
+func (opts TChangeOptions) withDefaults() TChangeOptions {
+	if opts.KeyColumn == "" {
+		opts.KeyColumn = defChangeKeyColumn
+	}
+	if opts.VersionColumn == "" {
+		opts.VersionColumn = defChangeVersionColumn
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defChangePollInterval
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(error) {}
+	}
+	return opts
+}
+
+func (sqldb TAegiSQLDB) pollChanges(ctx context.Context, opts TChangeOptions) (<-chan TChangeEvent, error) {
+	opts = opts.withDefaults()
+	// changes made before subscribing are not reported
+	cursors := make(map[string]*tChangeCursor)
+	for _, table := range opts.Tables {
+		cursor, err := sqldb.latestChange(ctx, table, opts)
+		if err != nil {
+			return nil, err
+		}
+		cursors[table] = cursor
+	}
+	out := make(chan TChangeEvent)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(opts.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, table := range opts.Tables {
+				err := sqldb.pollTable(ctx, table, opts, cursors[table], out)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					opts.OnError(err)
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Returns cursor positioned at the last change of the table
+func (sqldb TAegiSQLDB) latestChange(ctx context.Context, table string, opts TChangeOptions) (*tChangeCursor, error) {
+	query, args, err := sqldb.Build(Select(opts.KeyColumn, opts.VersionColumn).From(table).
+		OrderByDesc(opts.VersionColumn, opts.KeyColumn).Limit(1))
+	if err != nil {
+		return nil, err
+	}
+	cursor := &tChangeCursor{}
+	ctx, cancel := sqldb.withTimeout(ctx)
+	defer cancel()
+	err = sqldb.QueryRowContext(ctx, query, args...).Scan(&cursor.key, &cursor.version)
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return cursor, nil
+	}
+	return nil, err
+}
+
+// Sends changes of the table past the cursor, moving the cursor along
+func (sqldb TAegiSQLDB) pollTable(ctx context.Context, table string, opts TChangeOptions, cursor *tChangeCursor, out chan<- TChangeEvent) error {
+	for {
+		q := Select(opts.KeyColumn, opts.VersionColumn).From(table).
+			OrderBy(opts.VersionColumn, opts.KeyColumn).Limit(changePollBatch)
+		if cursor.version != nil {
+			q.Where(Or(Gt(opts.VersionColumn, cursor.version),
+				And(Eq(opts.VersionColumn, cursor.version), Gt(opts.KeyColumn, cursor.key))))
+		}
+		events, err := sqldb.changesAfter(ctx, table, q)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			select {
+			case out <- event.TChangeEvent:
+				cursor.key, cursor.version = event.rawKey, event.rawVersion
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if len(events) < changePollBatch {
+			return nil
+		}
+	}
+}
+
+func (sqldb TAegiSQLDB) changesAfter(ctx context.Context, table string, q *TSelectQuery) ([]tPolledChange, error) {
+	rows, err := sqldb.QueryDataBuiltCtx(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make([]tPolledChange, 0)
+	now := time.Now()
+	for rows.Next() {
+		var change tPolledChange
+		if err = rows.Scan(&change.rawKey, &change.rawVersion); err != nil {
+			return nil, err
+		}
+		change.TChangeEvent = TChangeEvent{Table: table, Op: ChangeUpsert, Key: readable(change.rawKey), Version: readable(change.rawVersion), Time: now}
+		events = append(events, change)
+	}
+	return events, rows.Err()
+}
+
+// Turns text MySQL returns as bytes into a string
+func readable(value any) any {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return value
+}
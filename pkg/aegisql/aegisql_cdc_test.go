@@ -0,0 +1,50 @@
+package aegisql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/UrsusArctos/dkit/pkg/aegisql"
+	"github.com/UrsusArctos/dkit/pkg/aegisql/aegisqltest"
+)
+
+// Reads events until none arrives for a while
+func drainChanges(changes <-chan aegisql.TChangeEvent) []aegisql.TChangeEvent {
+	var events []aegisql.TChangeEvent
+	for {
+		select {
+		case event := <-changes:
+			events = append(events, event)
+		case <-time.After(200 * time.Millisecond):
+			return events
+		}
+	}
+}
+
+func TestCaptureDeleteAll(t *testing.T) {
+	db, err := aegisql.OpenConfig(aegisql.TSQLiteConfig{Path: t.Name(), InMemory: true, SharedCache: true, Capture: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.ConfigurePool(aegisql.DefaultPoolConfig(aegisql.DriverSQLite3))
+	aegisqltest.Exec(t, db, "CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO t (name) VALUES ('a'), ('b'), ('c')")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := db.Subscribe(ctx, aegisql.TChangeOptions{Tables: []string{"t"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no WHERE, which SQLite would otherwise run as a truncate without calling the update hook
+	aegisqltest.Exec(t, db, "DELETE FROM t")
+	events := drainChanges(changes)
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3: %v", len(events), events)
+	}
+	for _, event := range events {
+		if event.Op != aegisql.ChangeDelete || event.Table != "t" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+}
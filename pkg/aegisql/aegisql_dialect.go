@@ -0,0 +1,274 @@
+package aegisql
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// Portable column kinds
+	KindInteger TColumnKind = iota
+	KindBigInt
+	KindString
+	KindText
+	KindReal
+	KindBlob
+	KindBool
+	KindTime
+	KindBinary // short byte string compared byte for byte, sized like KindString
+	// Length of KindString columns without explicit size
+	defStringSize = 255
+)
+
+type (
+	// SQL flavour of a particular backend
+	TDialect interface {
+		// Driver name this dialect belongs to
+		Name() string
+		// Quotes table or column name
+		QuoteIdent(name string) string
+		// Returns placeholder for n-th (1-based) bound argument
+		Placeholder(n int) string
+		// Returns column definition of an autoincrement primary key
+		AutoIncrementPK(column string) string
+		// Returns column type for a portable column kind
+		ColumnType(kind TColumnKind, size int) string
+		// Returns INSERT statement that updates non-key columns on key conflict, plain INSERT if there are no keys
+		Upsert(table string, columns []string, keys []string) string
+		// Returns LIMIT/OFFSET clause, negative limit means no limit
+		LimitOffset(limit int64, offset int64) string
+		// Tells if DDL statements can be rolled back
+		TransactionalDDL() bool
+		// Tells if a backslash escapes the next character in string literals
+		BackslashEscapes() bool
+	}
+
+	TSQLiteDialect struct{}
+
+	TMySQLDialect struct{}
+
+	TColumnKind int
+)
+
+// Returns dialect for the driver name as given to MakeDSN
+func DialectFor(driverName string) (TDialect, error) {
+	switch driverName {
+	case DriverSQLite3:
+		return TSQLiteDialect{}, nil
+	case DriverMySQL:
+		return TMySQLDialect{}, nil
+	default:
+		return nil, fmt.Errorf("no dialect for driver %q", driverName)
+	}
+}
+
+// Returns dialect of the driver the database was opened with
+func (sqldb TAegiSQLDB) Dialect() (TDialect, error) {
+	return DialectFor(sqldb.DriverName())
+}
+
+func quoteWith(name string, quote string) string {
+	return quote + strings.ReplaceAll(name, quote, quote+quote) + quote
+}
+
+// Returns comma separated list of quoted names
+func quoteList(d TDialect, names []string) string {
+	quoted := make([]string, len(names))
+	for i := range names {
+		quoted[i] = d.QuoteIdent(names[i])
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Returns comma separated list of placeholders starting with n-th
+func placeholderList(d TDialect, first int, count int) string {
+	ph := make([]string, count)
+	for i := range ph {
+		ph[i] = d.Placeholder(first + i)
+	}
+	return strings.Join(ph, ", ")
+}
+
+// Returns columns that are not among keys
+func nonKeyColumns(columns []string, keys []string) []string {
+	result := make([]string, 0, len(columns))
+	for _, column := range columns {
+		isKey := false
+		for _, key := range keys {
+			if key == column {
+				isKey = true
+			}
+		}
+		if !isKey {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+// SQLITE
+
+func (TSQLiteDialect) Name() string {
+	return DriverSQLite3
+}
+
+func (TSQLiteDialect) QuoteIdent(name string) string {
+	return quoteWith(name, `"`)
+}
+
+func (TSQLiteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (d TSQLiteDialect) AutoIncrementPK(column string) string {
+	return fmt.Sprintf("%s INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT", d.QuoteIdent(column))
+}
+
+func (TSQLiteDialect) ColumnType(kind TColumnKind, size int) string {
+	switch kind {
+	case KindInteger, KindBigInt, KindBool:
+		return "INTEGER"
+	case KindString:
+		if size <= 0 {
+			size = defStringSize
+		}
+		return fmt.Sprintf("VARCHAR(%d)", size)
+	case KindBinary:
+		// text already compares byte for byte here, and stays text for LIKE
+		if size <= 0 {
+			size = defStringSize
+		}
+		return fmt.Sprintf("VARCHAR(%d)", size)
+	case KindReal:
+		return "REAL"
+	case KindBlob:
+		return "BLOB"
+	case KindTime:
+		return "DATETIME"
+	default:
+		return "TEXT"
+	}
+}
+
+func (d TSQLiteDialect) Upsert(table string, columns []string, keys []string) string {
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", d.QuoteIdent(table), quoteList(d, columns), placeholderList(d, 1, len(columns)))
+	if len(keys) == 0 {
+		return insert
+	}
+	insert += fmt.Sprintf(" ON CONFLICT (%s) DO ", quoteList(d, keys))
+	update := nonKeyColumns(columns, keys)
+	if len(update) == 0 {
+		return insert + "NOTHING"
+	}
+	set := make([]string, len(update))
+	for i := range update {
+		set[i] = fmt.Sprintf("%s = excluded.%s", d.QuoteIdent(update[i]), d.QuoteIdent(update[i]))
+	}
+	return insert + "UPDATE SET " + strings.Join(set, ", ")
+}
+
+func (TSQLiteDialect) LimitOffset(limit int64, offset int64) string {
+	if offset > 0 {
+		return fmt.Sprintf("LIMIT %d OFFSET %d", max(limit, -1), offset)
+	}
+	if limit >= 0 {
+		return fmt.Sprintf("LIMIT %d", limit)
+	}
+	return ""
+}
+
+func (TSQLiteDialect) TransactionalDDL() bool {
+	return true
+}
+
+func (TSQLiteDialect) BackslashEscapes() bool {
+	return false
+}
+
+// MYSQL
+
+func (TMySQLDialect) Name() string {
+	return DriverMySQL
+}
+
+func (TMySQLDialect) QuoteIdent(name string) string {
+	return quoteWith(name, "`")
+}
+
+func (TMySQLDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (d TMySQLDialect) AutoIncrementPK(column string) string {
+	return fmt.Sprintf("%s BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY", d.QuoteIdent(column))
+}
+
+func (TMySQLDialect) ColumnType(kind TColumnKind, size int) string {
+	switch kind {
+	case KindInteger:
+		return "INT"
+	case KindBigInt:
+		return "BIGINT"
+	case KindBool:
+		return "TINYINT(1)"
+	case KindString:
+		if size <= 0 {
+			size = defStringSize
+		}
+		return fmt.Sprintf("VARCHAR(%d)", size)
+	case KindBinary:
+		if size <= 0 {
+			size = defStringSize
+		}
+		return fmt.Sprintf("VARBINARY(%d)", size)
+	case KindReal:
+		return "DOUBLE"
+	case KindBlob:
+		return "LONGBLOB"
+	case KindTime:
+		return "DATETIME(6)"
+	default:
+		return "LONGTEXT"
+	}
+}
+
+func (d TMySQLDialect) Upsert(table string, columns []string, keys []string) string {
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", d.QuoteIdent(table), quoteList(d, columns), placeholderList(d, 1, len(columns)))
+	if len(keys) == 0 {
+		return insert
+	}
+	insert += " ON DUPLICATE KEY UPDATE "
+	update := nonKeyColumns(columns, keys)
+	if len(update) == 0 {
+		// nothing to update, turn it into a no-op
+		return insert + fmt.Sprintf("%s = %s", d.QuoteIdent(keys[0]), d.QuoteIdent(keys[0]))
+	}
+	set := make([]string, len(update))
+	for i := range update {
+		set[i] = fmt.Sprintf("%s = VALUES(%s)", d.QuoteIdent(update[i]), d.QuoteIdent(update[i]))
+	}
+	return insert + strings.Join(set, ", ")
+}
+
+func (TMySQLDialect) LimitOffset(limit int64, offset int64) string {
+	if limit < 0 && offset > 0 {
+		// MySQL has no syntax for offset without limit
+		return fmt.Sprintf("LIMIT 18446744073709551615 OFFSET %d", offset)
+	}
+	if offset > 0 {
+		return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+	}
+	if limit >= 0 {
+		return fmt.Sprintf("LIMIT %d", limit)
+	}
+	return ""
+}
+
+func (TMySQLDialect) TransactionalDDL() bool {
+	return false
+}
+
+// True unless the server runs with NO_BACKSLASH_ESCAPES
+func (TMySQLDialect) BackslashEscapes() bool {
+	return true
+}
@@ -0,0 +1,28 @@
+package aegisql_test
+
+import (
+	"testing"
+
+	"github.com/UrsusArctos/dkit/pkg/aegisql"
+)
+
+func TestUpsert(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		d       aegisql.TDialect
+		columns []string
+		keys    []string
+		want    string
+	}{
+		{"sqlite", aegisql.TSQLiteDialect{}, []string{"id", "v"}, []string{"id"}, `INSERT INTO "t" ("id", "v") VALUES (?, ?) ON CONFLICT ("id") DO UPDATE SET "v" = excluded."v"`},
+		{"sqlite keys only", aegisql.TSQLiteDialect{}, []string{"id"}, []string{"id"}, `INSERT INTO "t" ("id") VALUES (?) ON CONFLICT ("id") DO NOTHING`},
+		{"sqlite no keys", aegisql.TSQLiteDialect{}, []string{"v"}, nil, `INSERT INTO "t" ("v") VALUES (?)`},
+		{"mysql", aegisql.TMySQLDialect{}, []string{"id", "v"}, []string{"id"}, "INSERT INTO `t` (`id`, `v`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `v` = VALUES(`v`)"},
+		{"mysql keys only", aegisql.TMySQLDialect{}, []string{"id"}, []string{"id"}, "INSERT INTO `t` (`id`) VALUES (?) ON DUPLICATE KEY UPDATE `id` = `id`"},
+		{"mysql no keys", aegisql.TMySQLDialect{}, nil, nil, "INSERT INTO `t` () VALUES ()"},
+	} {
+		if got := tc.d.Upsert("t", tc.columns, tc.keys); got != tc.want {
+			t.Errorf("%s:\n  want: %s\n  got:  %s", tc.name, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package aegisql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/UrsusArctos/dkit/pkg/aegisql"
+)
+
+func TestInMemorySharedByPool(t *testing.T) {
+	db, err := aegisql.OpenConfig(aegisql.TSQLiteConfig{Path: t.Name(), InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	first, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if _, err = first.ExecContext(ctx, "CREATE TABLE t (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = second.ExecContext(ctx, "INSERT INTO t (id) VALUES (1)"); err != nil {
+		t.Errorf("second connection does not see the table: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package aegisql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Search defaults
+	defFTSLimit         = 20
+	defFTSSnippetTokens = 16
+	defFTSMarkOpen      = "<b>"
+	defFTSMarkClose     = "</b>"
+	defFTSEllipsis      = "…"
+	// FTS5 limit on snippet length
+	maxFTSSnippetTokens = 64
+	// Trigger name suffixes
+	ftsTriggerInsert = "_ai"
+	ftsTriggerDelete = "_ad"
+	ftsTriggerUpdate = "_au"
+)
+
+type (
+	// Full-text index kept by FTS5 over columns of a content table
+	TFTSIndex struct {
+		db           TAegiSQLDB
+		name         string
+		contentTable string
+		contentRowID string
+		columns      []string
+	}
+
+	// Settings of index creation
+	TFTSOptions struct {
+		Tokenizer string // e.g. "unicode61 remove_diacritics 2", FTS5 default if empty
+		Prefix    []int  // prefix lengths to index for faster "term*" queries
+	}
+
+	// Settings of a search
+	TFTSSearchOptions struct {
+		Limit         int // defaults to 20
+		Offset        int
+		Column        string // column for snippet and highlight, the first indexed one if empty
+		MarkOpen      string // text placed before a matched term, defaults to <b>
+		MarkClose     string // text placed after a matched term, defaults to </b>
+		Ellipsis      string // text marking cut off snippet ends, defaults to …
+		SnippetTokens int    // snippet length in tokens, defaults to 16, at most 64
+	}
+
+	// Single search result
+	TFTSMatch struct {
+		RowID     int64   // value of the content table row id column
+		Rank      float64 // bm25 score, lower is a better match
+		Snippet   string  // matching fragment of the column with terms marked
+		Highlight string  // whole column with terms marked
+	}
+)
+
+// Creates (if needed) FTS5 table mirroring the columns of contentTable, whose integer key is contentRowID,
+// along with triggers keeping it in sync. Rows existing before the index was created are indexed as well.
+// FTS5 is not compiled into the sqlite3 driver by default, build with -tags sqlite_fts5.
+func NewFTS(ctx context.Context, sqldb TAegiSQLDB, name string, contentTable string, contentRowID string, columns []string, opts TFTSOptions) (*TFTSIndex, error) {
+	if sqldb.DriverName() != DriverSQLite3 {
+		return nil, fmt.Errorf("full-text index is not supported for driver %q", sqldb.DriverName())
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no columns to index")
+	}
+	fts := &TFTSIndex{db: sqldb, name: name, contentTable: contentTable, contentRowID: contentRowID, columns: columns}
+	created := false
+	err := sqldb.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		created = exists == 0
+		if !created {
+			return nil
+		}
+		for _, query := range fts.createSQL(opts) {
+			if _, err = tx.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && created {
+		err = fts.Rebuild(ctx)
+	}
+	if err == nil {
+		return fts, nil
+	}
+	return nil, err
+}
+
+func (fts *TFTSIndex) createSQL(opts TFTSOptions) []string {
+	d := TSQLiteDialect{}
+	args := quoteList(d, fts.columns)
+	args += ", content=" + sqlString(fts.contentTable) + ", content_rowid=" + sqlString(fts.contentRowID)
+	if opts.Tokenizer != "" {
+		args += ", tokenize=" + sqlString(opts.Tokenizer)
+	}
+	if len(opts.Prefix) > 0 {
+		prefixes := make([]string, len(opts.Prefix))
+		for i, p := range opts.Prefix {
+			prefixes[i] = fmt.Sprint(p)
+		}
+		args += ", prefix=" + sqlString(strings.Join(prefixes, " "))
+	}
+	name := d.QuoteIdent(fts.name)
+	content := d.QuoteIdent(fts.contentTable)
+	rowID := d.QuoteIdent(fts.contentRowID)
+	columns := quoteList(d, fts.columns)
+	values := func(prefix string) string {
+		list := prefix + "." + rowID
+		for _, column := range fts.columns {
+			list += ", " + prefix + "." + d.QuoteIdent(column)
+		}
+		return list
+	}
+	insertNew := fmt.Sprintf("INSERT INTO %s (rowid, %s) VALUES (%s);", name, columns, values("new"))
+	deleteOld := fmt.Sprintf("INSERT INTO %s (%s, rowid, %s) VALUES ('delete', %s);", name, name, columns, values("old"))
+	return []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5(%s)", name, args),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s BEGIN %s END",
+			d.QuoteIdent(fts.name+ftsTriggerInsert), content, insertNew),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s BEGIN %s END",
+			d.QuoteIdent(fts.name+ftsTriggerDelete), content, deleteOld),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s BEGIN %s %s END",
+			d.QuoteIdent(fts.name+ftsTriggerUpdate), content, deleteOld, insertNew),
+	}
+}
+
+// Returns SQL string literal
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Reindexes the whole content table, e.g. after it was changed with triggers disabled
+func (fts *TFTSIndex) Rebuild(ctx context.Context) error {
+	name := TSQLiteDialect{}.QuoteIdent(fts.name)
+	_, err := fts.db.QuerySingleCtx(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES ('rebuild')", name, name))
+	return err
+}
+
+// Drops the index and its triggers, leaving the content table intact
+func (fts *TFTSIndex) Drop(ctx context.Context) error {
+	d := TSQLiteDialect{}
+	return fts.db.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		for _, suffix := range []string{ftsTriggerInsert, ftsTriggerDelete, ftsTriggerUpdate} {
+			if _, err := tx.ExecContext(ctx, "DROP TRIGGER IF EXISTS "+d.QuoteIdent(fts.name+suffix)); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+d.QuoteIdent(fts.name))
+		return err
+	})
+}
+
+func (opts TFTSSearchOptions) withDefaults() TFTSSearchOptions {
+	if opts.Limit <= 0 {
+		opts.Limit = defFTSLimit
+	}
+	if opts.MarkOpen == "" && opts.MarkClose == "" {
+		opts.MarkOpen, opts.MarkClose = defFTSMarkOpen, defFTSMarkClose
+	}
+	if opts.Ellipsis == "" {
+		opts.Ellipsis = defFTSEllipsis
+	}
+	if opts.SnippetTokens <= 0 {
+		opts.SnippetTokens = defFTSSnippetTokens
+	}
+	opts.SnippetTokens = min(opts.SnippetTokens, maxFTSSnippetTokens)
+	return opts
+}
+
+// Runs FTS5 query (see QuoteFTSQuery for plain user input) and returns matches, best first
+func (fts *TFTSIndex) Search(ctx context.Context, match string, opts TFTSSearchOptions) ([]TFTSMatch, error) {
+	opts = opts.withDefaults()
+	column := 0
+	if opts.Column != "" {
+		column = -1
+		for i := range fts.columns {
+			if strings.EqualFold(fts.columns[i], opts.Column) {
+				column = i
+			}
+		}
+		if column < 0 {
+			return nil, fmt.Errorf("column %q is not indexed", opts.Column)
+		}
+	}
+	name := TSQLiteDialect{}.QuoteIdent(fts.name)
+	query := fmt.Sprintf("SELECT rowid, rank, snippet(%s, %d, ?, ?, ?, ?), highlight(%s, %d, ?, ?) FROM %s WHERE %s MATCH ? ORDER BY rank LIMIT ? OFFSET ?",
+		name, column, name, column, name, name)
+	rows, err := fts.db.QueryDataCtx(ctx, query,
+		opts.MarkOpen, opts.MarkClose, opts.Ellipsis, opts.SnippetTokens,
+		opts.MarkOpen, opts.MarkClose,
+		match, opts.Limit, opts.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	matches := make([]TFTSMatch, 0)
+	for rows.Next() {
+		var (
+			m                  TFTSMatch
+			snippet, highlight sql.NullString
+		)
+		if err = rows.Scan(&m.RowID, &m.Rank, &snippet, &highlight); err != nil {
+			return nil, err
+		}
+		m.Snippet, m.Highlight = snippet.String, highlight.String
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// Turns plain text into FTS5 query matching all of its words, so that user input
+// containing quotes, operators or column filters cannot break the query syntax
+func QuoteFTSQuery(text string) string {
+	words := strings.Fields(text)
+	for i := range words {
+		words[i] = `"` + strings.ReplaceAll(words[i], `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
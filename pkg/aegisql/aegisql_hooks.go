@@ -0,0 +1,147 @@
+package aegisql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Kinds of traced queries
+	QueryExec TQueryKind = iota // QuerySingle
+	QueryRows                   // QueryData
+	// Longest query text written to the log
+	maxLoggedQuery = 500
+)
+
+type (
+	TQueryKind int
+
+	// Describes a query to hooks; Duration, RowsAffected and Err are only set after the query
+	TQueryEvent struct {
+		Kind         TQueryKind
+		Query        string
+		Args         []any // as returned by the redact function
+		Started      time.Time
+		Duration     time.Duration
+		RowsAffected int64 // -1 when unknown, always for QueryRows
+		Err          error
+	}
+
+	// Observes queries run by QuerySingle and QueryData, must be safe for concurrent use
+	TQueryHook interface {
+		BeforeQuery(ctx context.Context, event TQueryEvent)
+		AfterQuery(ctx context.Context, event TQueryEvent)
+	}
+
+	// Returns arguments as hooks should see them, must not modify args
+	TRedactFunc func(query string, args []any) []any
+
+	// Hook writing queries to a logger
+	tLogHook struct {
+		logger    TEventLogger
+		threshold time.Duration
+		all       bool
+	}
+)
+
+// Keeps numbers, booleans, times and NULLs, replaces text, bytes and other values with their size or type
+func RedactValues(query string, args []any) []any {
+	redacted := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, time.Time:
+			redacted[i] = v
+		case string:
+			redacted[i] = fmt.Sprintf("<%d chars>", len(v))
+		case []byte:
+			redacted[i] = fmt.Sprintf("<%d bytes>", len(v))
+		default:
+			redacted[i] = fmt.Sprintf("<%T>", v)
+		}
+	}
+	return redacted
+}
+
+// Shows arguments as they are, for development only
+func KeepArgs(query string, args []any) []any {
+	return args
+}
+
+// Hides all arguments
+func RedactAll(query string, args []any) []any {
+	return nil
+}
+
+// Notifies hooks of a starting query, returns function to call once it is done
+func (sqldb TAegiSQLDB) trace(ctx context.Context, kind TQueryKind, query string, args []any) func(res sql.Result, err error) {
+	if len(sqldb.Hooks) == 0 {
+		return func(sql.Result, error) {}
+	}
+	redact := sqldb.Redact
+	if redact == nil {
+		redact = RedactValues
+	}
+	event := TQueryEvent{Kind: kind, Query: query, Args: redact(query, args), Started: time.Now(), RowsAffected: -1}
+	for _, hook := range sqldb.Hooks {
+		hook.BeforeQuery(ctx, event)
+	}
+	return func(res sql.Result, err error) {
+		event.Duration = time.Since(event.Started)
+		event.Err = err
+		if res != nil {
+			if affected, aerr := res.RowsAffected(); aerr == nil {
+				event.RowsAffected = affected
+			}
+		}
+		for _, hook := range sqldb.Hooks {
+			hook.AfterQuery(ctx, event)
+		}
+	}
+}
+
+// Returns hook logging queries that took at least threshold as warnings and failed ones as errors
+func SlowQueryLog(logger TEventLogger, threshold time.Duration) TQueryHook {
+	return tLogHook{logger: logger, threshold: threshold}
+}
+
+// Returns hook logging every query as info and failed ones as errors
+func QueryLog(logger TEventLogger) TQueryHook {
+	return tLogHook{logger: logger, all: true}
+}
+
+func (hook tLogHook) BeforeQuery(ctx context.Context, event TQueryEvent) {}
+
+func (hook tLogHook) AfterQuery(ctx context.Context, event TQueryEvent) {
+	switch {
+	case event.Err != nil:
+		hook.logger.LogEventError(fmt.Sprintf("query failed after %s: %v; %s", event.Duration, event.Err, event))
+	case !hook.all && event.Duration >= hook.threshold:
+		hook.logger.LogEventWarning(fmt.Sprintf("slow query took %s: %s", event.Duration, event))
+	case hook.all:
+		hook.logger.LogEventInfo(fmt.Sprintf("query took %s: %s", event.Duration, event))
+	}
+}
+
+// Query text on one line, shortened if too long, with arguments and rows affected
+func (event TQueryEvent) String() string {
+	query := strings.Join(strings.Fields(event.Query), " ")
+	if len(query) > maxLoggedQuery {
+		cut := maxLoggedQuery
+		for !utf8.RuneStart(query[cut]) {
+			cut--
+		}
+		query = query[:cut] + "..."
+	}
+	result := query
+	if len(event.Args) > 0 {
+		result += fmt.Sprintf(" %v", event.Args)
+	}
+	if event.RowsAffected >= 0 {
+		result += fmt.Sprintf(" (%d rows)", event.RowsAffected)
+	}
+	return result
+}
@@ -0,0 +1,111 @@
+package aegisql
+
+import (
+	"context"
+	"errors"
+)
+
+type (
+	// Push iterator, same shape as iter.Seq so it can be ranged over once the module moves to Go 1.23
+	TSeq[V any] func(yield func(V) bool)
+
+	// Reads one value from rows, returns ErrNoMoreRows at the end
+	tUnloader[V any] func(ctx context.Context, rows TAegiSQLRows) (V, error)
+)
+
+// Returns sequence that runs the query on iteration and always closes its rows,
+// along with a function reporting the error that ended the last iteration, if any
+func sequenceOf[V any](ctx context.Context, sqldb TAegiSQLDB, unload tUnloader[V], query string, args ...any) (TSeq[V], func() error) {
+	var err error
+	seq := func(yield func(V) bool) {
+		rows, qerr := sqldb.QueryDataCtx(ctx, query, args...)
+		if qerr != nil {
+			err = qerr
+			return
+		}
+		defer rows.Close()
+		for {
+			value, uerr := unload(ctx, rows)
+			if errors.Is(uerr, ErrNoMoreRows) {
+				err = nil
+				return
+			}
+			if uerr != nil {
+				err = uerr
+				return
+			}
+			if !yield(value) {
+				// early break is not an error
+				err = nil
+				return
+			}
+		}
+	}
+	return seq, func() error { return err }
+}
+
+func unloadTyped(ctx context.Context, rows TAegiSQLRows) (TAegiSQLTypedRow, error) {
+	return rows.UnloadNextTypedRowCtx(ctx)
+}
+
+func unloadStruct[T any](ctx context.Context, rows TAegiSQLRows) (T, error) {
+	var zero T
+	item, err := UnloadIntoCtx[T](ctx, rows)
+	if err == nil {
+		if item == nil {
+			return zero, ErrNoMoreRows
+		}
+		return *item, nil
+	}
+	return zero, err
+}
+
+// Returns sequence of typed rows and its terminal error
+func (sqldb TAegiSQLDB) All(query string, args ...any) (TSeq[TAegiSQLTypedRow], func() error) {
+	return sqldb.AllCtx(context.Background(), query, args...)
+}
+
+func (sqldb TAegiSQLDB) AllCtx(ctx context.Context, query string, args ...any) (TSeq[TAegiSQLTypedRow], func() error) {
+	return sequenceOf(ctx, sqldb, unloadTyped, query, args...)
+}
+
+// Returns sequence of rows scanned into T and its terminal error
+func AllStructs[T any](sqldb TAegiSQLDB, query string, args ...any) (TSeq[T], func() error) {
+	return AllStructsCtx[T](context.Background(), sqldb, query, args...)
+}
+
+func AllStructsCtx[T any](ctx context.Context, sqldb TAegiSQLDB, query string, args ...any) (TSeq[T], func() error) {
+	return sequenceOf(ctx, sqldb, unloadStruct[T], query, args...)
+}
+
+// Calls fn for every typed row, stops on the first error
+func (sqldb TAegiSQLDB) Each(query string, fn func(row TAegiSQLTypedRow) error, args ...any) error {
+	return sqldb.EachCtx(context.Background(), query, fn, args...)
+}
+
+func (sqldb TAegiSQLDB) EachCtx(ctx context.Context, query string, fn func(row TAegiSQLTypedRow) error, args ...any) error {
+	return eachOf(sqldb.AllCtx(ctx, query, args...))(fn)
+}
+
+// Calls fn for every row scanned into T, stops on the first error
+func EachStruct[T any](sqldb TAegiSQLDB, query string, fn func(item T) error, args ...any) error {
+	return EachStructCtx[T](context.Background(), sqldb, query, fn, args...)
+}
+
+func EachStructCtx[T any](ctx context.Context, sqldb TAegiSQLDB, query string, fn func(item T) error, args ...any) error {
+	return eachOf(AllStructsCtx[T](ctx, sqldb, query, args...))(fn)
+}
+
+func eachOf[V any](seq TSeq[V], seqErr func() error) func(fn func(V) error) error {
+	return func(fn func(V) error) error {
+		var fnErr error
+		seq(func(value V) bool {
+			fnErr = fn(value)
+			return fnErr == nil
+		})
+		if fnErr != nil {
+			return fnErr
+		}
+		return seqErr()
+	}
+}
@@ -0,0 +1,251 @@
+package aegisql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// KV table layout
+	kvColKey     = "k"
+	kvColValue   = "v"
+	kvColExpires = "expires_at"
+	kvKeySize    = 767 // longest key in bytes MySQL can index on older row formats
+	// MySQL error "Duplicate entry"
+	mysqlErrDupEntry = 1062
+	// LIKE escape character
+	likeEscape = "!"
+)
+
+type (
+	// Key-value store with JSON values and optional expiry, kept in a single table
+	TAegiKV struct {
+		db     TAegiSQLDB
+		table  string
+		prefix string
+	}
+
+	// Single entry returned by List
+	TKVEntry struct {
+		Key       string
+		Value     json.RawMessage
+		ExpiresAt time.Time // zero if the entry never expires
+	}
+)
+
+// Opens key-value store kept in the table, creating the table if needed
+func NewKV(ctx context.Context, sqldb TAegiSQLDB, table string) (*TAegiKV, error) {
+	td := NewTable(table).
+		Column(kvColKey, KindBinary, Size(kvKeySize)). // keys differing in case or trailing spaces must not collide
+		Column(kvColValue, KindBlob).                  // compared byte for byte, unlike text with MySQL collations
+		Column(kvColExpires, KindBigInt, Nullable()).
+		Key(kvColKey).
+		Index(table+"_"+kvColExpires, kvColExpires)
+	err := sqldb.CreateTableCtx(ctx, td)
+	if err == nil {
+		return &TAegiKV{db: sqldb, table: table}, nil
+	}
+	return nil, err
+}
+
+// Returns view of the store where all keys get the prefix, e.g. per-chat state
+func (kv *TAegiKV) Scope(prefix string) *TAegiKV {
+	return &TAegiKV{db: kv.db, table: kv.table, prefix: kv.prefix + prefix}
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// Condition matching entries that have not expired yet
+func notExpired() TCond {
+	return Or(IsNull(kvColExpires), Gt(kvColExpires, nowMillis()))
+}
+
+func expiryOf(ttl time.Duration) any {
+	if ttl > 0 {
+		return time.Now().Add(ttl).UnixMilli()
+	}
+	return nil
+}
+
+// Tells if the error is a unique key violation
+func isDuplicate(err error) bool {
+	var (
+		liteErr sqlite3.Error
+		myErr   *mysql.MySQLError
+	)
+	if errors.As(err, &liteErr) {
+		return liteErr.Code == sqlite3.ErrConstraint
+	}
+	if errors.As(err, &myErr) {
+		return myErr.Number == mysqlErrDupEntry
+	}
+	return false
+}
+
+// Decodes value of the key into dest, reports false if there is no such (live) key
+func (kv *TAegiKV) Get(ctx context.Context, key string, dest any) (bool, error) {
+	query, args, err := kv.db.Build(Select(kvColValue).From(kv.table).Where(Eq(kvColKey, kv.prefix+key), notExpired()))
+	if err != nil {
+		return false, err
+	}
+	var raw []byte
+	ctx, cancel := kv.db.withTimeout(ctx)
+	defer cancel()
+	err = kv.db.QueryRowContext(ctx, query, args...).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err == nil {
+		return true, json.Unmarshal(raw, dest)
+	}
+	return false, err
+}
+
+// Stores value as JSON, ttl of 0 means it never expires
+func (kv *TAegiKV) Set(ctx context.Context, key string, value any, ttl time.Duration) error {
+	encoded, err := json.Marshal(value)
+	if err == nil {
+		d, derr := kv.db.Dialect()
+		if derr == nil {
+			query := d.Upsert(kv.table, []string{kvColKey, kvColValue, kvColExpires}, []string{kvColKey})
+			_, err = kv.db.QuerySingleCtx(ctx, query, kv.prefix+key, encoded, expiryOf(ttl))
+			return err
+		}
+		return derr
+	}
+	return err
+}
+
+// Removes the key, reports whether it was there
+func (kv *TAegiKV) Delete(ctx context.Context, key string) (bool, error) {
+	res, err := kv.db.QuerySingleBuiltCtx(ctx, Delete(kv.table).Where(Eq(kvColKey, kv.prefix+key), notExpired()))
+	if err == nil {
+		affected, aerr := res.RowsAffected()
+		return affected > 0, aerr
+	}
+	return false, err
+}
+
+// Returns live entries whose keys start with prefix, ordered by key
+func (kv *TAegiKV) List(ctx context.Context, prefix string) ([]TKVEntry, error) {
+	escaped := strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_").Replace(kv.prefix + prefix)
+	q := Select(kvColKey, kvColValue, kvColExpires).From(kv.table).
+		Where(Expr(kvColKey+" LIKE ? ESCAPE '"+likeEscape+"'", escaped+"%"), notExpired()).
+		OrderBy(kvColKey)
+	rows, err := kv.db.QueryDataBuiltCtx(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := make([]TKVEntry, 0)
+	for rows.Next() {
+		var (
+			entry   TKVEntry
+			value   []byte
+			expires sql.NullInt64
+		)
+		if err = rows.Scan(&entry.Key, &value, &expires); err != nil {
+			return nil, err
+		}
+		entry.Key = strings.TrimPrefix(entry.Key, kv.prefix)
+		entry.Value = json.RawMessage(value)
+		if expires.Valid {
+			entry.ExpiresAt = time.UnixMilli(expires.Int64)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Replaces value only if the current one encodes to the same JSON as old; nil old means the key must be absent.
+// Reports whether the swap happened.
+func (kv *TAegiKV) CompareAndSwap(ctx context.Context, key string, old any, value any, ttl time.Duration) (bool, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	if old == nil {
+		return kv.insertIfAbsent(ctx, key, encoded, ttl)
+	}
+	oldEncoded, err := json.Marshal(old)
+	if err != nil {
+		return false, err
+	}
+	q := Update(kv.table).Set(kvColValue, encoded).Set(kvColExpires, expiryOf(ttl)).
+		Where(Eq(kvColKey, kv.prefix+key), Eq(kvColValue, oldEncoded), notExpired())
+	res, err := kv.db.QuerySingleBuiltCtx(ctx, q)
+	if err == nil {
+		affected, aerr := res.RowsAffected()
+		if affected == 0 && aerr == nil && bytes.Equal(encoded, oldEncoded) {
+			// MySQL does not count rows left unchanged, swapping to the same value succeeds if the entry holds it
+			return kv.holds(ctx, key, oldEncoded)
+		}
+		return affected > 0, aerr
+	}
+	return false, err
+}
+
+// Tells if the live entry of the key has exactly the encoded value
+func (kv *TAegiKV) holds(ctx context.Context, key string, encoded []byte) (bool, error) {
+	query, args, err := kv.db.Build(Select(kvColKey).From(kv.table).Where(Eq(kvColKey, kv.prefix+key), Eq(kvColValue, encoded), notExpired()))
+	if err != nil {
+		return false, err
+	}
+	var found string
+	ctx, cancel := kv.db.withTimeout(ctx)
+	defer cancel()
+	err = kv.db.QueryRowContext(ctx, query, args...).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (kv *TAegiKV) insertIfAbsent(ctx context.Context, key string, encoded []byte, ttl time.Duration) (bool, error) {
+	inserted := false
+	err := kv.db.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		inserted = false
+		d, derr := kv.db.Dialect()
+		if derr != nil {
+			return derr
+		}
+		// an expired entry counts as absent
+		query, args, berr := Delete(kv.table).Where(Eq(kvColKey, kv.prefix+key), Not(notExpired())).Build(d)
+		if berr != nil {
+			return berr
+		}
+		if _, eerr := tx.ExecContext(ctx, query, args...); eerr != nil {
+			return eerr
+		}
+		query, args, berr = Insert(kv.table).Columns(kvColKey, kvColValue, kvColExpires).Values(kv.prefix+key, encoded, expiryOf(ttl)).Build(d)
+		if berr != nil {
+			return berr
+		}
+		_, eerr := tx.ExecContext(ctx, query, args...)
+		if isDuplicate(eerr) {
+			return nil
+		}
+		inserted = eerr == nil
+		return eerr
+	})
+	return inserted, err
+}
+
+// Deletes expired entries of the whole table, returns their number
+func (kv *TAegiKV) Purge(ctx context.Context) (int64, error) {
+	res, err := kv.db.QuerySingleBuiltCtx(ctx, Delete(kv.table).Where(NotNull(kvColExpires), Le(kvColExpires, nowMillis())))
+	if err == nil {
+		return res.RowsAffected()
+	}
+	return 0, err
+}
@@ -0,0 +1,34 @@
+package aegisql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/UrsusArctos/dkit/pkg/aegisql"
+	"github.com/UrsusArctos/dkit/pkg/aegisql/aegisqltest"
+)
+
+func TestKVKeysAndSwap(t *testing.T) {
+	if got := (aegisql.TMySQLDialect{}).ColumnType(aegisql.KindBinary, 767); got != "VARBINARY(767)" {
+		t.Errorf("MySQL key column is %s", got)
+	}
+	ctx := context.Background()
+	kv, err := aegisql.NewKV(ctx, aegisqltest.NewDB(t, aegisqltest.TFixture{}), "kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "A", "a "} {
+		if err = kv.Set(ctx, key, key, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries, lerr := kv.List(ctx, ""); lerr != nil || len(entries) != 3 {
+		t.Errorf("want 3 distinct keys, got %v (%v)", entries, lerr)
+	}
+	if swapped, serr := kv.CompareAndSwap(ctx, "a", "a", "a", 0); serr != nil || !swapped {
+		t.Errorf("swap to the same value reported %v, %v", swapped, serr)
+	}
+	if swapped, serr := kv.CompareAndSwap(ctx, "a", "x", "a", 0); serr != nil || swapped {
+		t.Errorf("swap from a wrong value reported %v, %v", swapped, serr)
+	}
+}
@@ -0,0 +1,291 @@
+package aegisql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// Table that keeps track of applied migrations
+	DefaultMigrationTable = "aegisql_schema"
+	// Script variant used when there is none for the current dialect
+	AnyDialect = ""
+	// Migration file directions
+	dirUp   = "up"
+	dirDown = "down"
+)
+
+type (
+	// SQL script of a migration step, keyed by driver name (or AnyDialect)
+	TMigrationScript map[string]string
+
+	// Defines a single versioned schema change
+	TMigration struct {
+		Version int64
+		Name    string
+		Up      TMigrationScript
+		Down    TMigrationScript
+	}
+
+	// Describes a migration recorded in the schema table
+	TAppliedMigration struct {
+		Version   int64
+		Name      string
+		AppliedAt time.Time
+	}
+
+	// Applies migrations to the database
+	TMigrator struct {
+		db         TAegiSQLDB
+		migrations map[int64]TMigration
+		Table      string
+	}
+
+	// Common part of *sql.DB and *sql.Tx
+	tExecer interface {
+		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	}
+)
+
+// Migration file names look like 0001_create_users.up.sql or 0001_create_users.down.mysql.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_([^.]+)\.(up|down)(?:\.([a-z0-9]+))?\.sql$`)
+
+func NewMigrator(sqldb TAegiSQLDB, migrations ...TMigration) (*TMigrator, error) {
+	m := &TMigrator{
+		db:         sqldb,
+		migrations: make(map[int64]TMigration),
+		Table:      DefaultMigrationTable,
+	}
+	return m, m.Register(migrations...)
+}
+
+// Adds migrations defined in Go code
+func (m *TMigrator) Register(migrations ...TMigration) error {
+	for _, mig := range migrations {
+		if mig.Version <= 0 {
+			return fmt.Errorf("migration %q has invalid version %d", mig.Name, mig.Version)
+		}
+		if _, dup := m.migrations[mig.Version]; dup {
+			return fmt.Errorf("migration version %d is registered twice", mig.Version)
+		}
+		m.migrations[mig.Version] = mig
+	}
+	return nil
+}
+
+// Adds migrations from *.sql files in a directory of fsys (e.g. embed.FS)
+func (m *TMigrator) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err == nil {
+		loaded := make(map[int64]TMigration)
+		for _, entry := range entries {
+			parts := migrationFileName.FindStringSubmatch(entry.Name())
+			if entry.IsDir() || parts == nil {
+				continue
+			}
+			version, _ := strconv.ParseInt(parts[1], 10, 64)
+			script, rerr := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+			if rerr != nil {
+				return rerr
+			}
+			mig, ok := loaded[version]
+			if !ok {
+				mig = TMigration{Version: version, Name: parts[2], Up: TMigrationScript{}, Down: TMigrationScript{}}
+			} else if mig.Name != parts[2] {
+				return fmt.Errorf("migration version %d has conflicting names %q and %q", version, mig.Name, parts[2])
+			}
+			if parts[3] == dirUp {
+				mig.Up[parts[4]] = string(script)
+			} else {
+				mig.Down[parts[4]] = string(script)
+			}
+			loaded[version] = mig
+		}
+		for _, mig := range loaded {
+			if rerr := m.Register(mig); rerr != nil {
+				return rerr
+			}
+		}
+		return nil
+	}
+	return err
+}
+
+// Returns script variant for the driver, falling back to AnyDialect
+func (ms TMigrationScript) forDriver(driverName string) (string, bool) {
+	if script, ok := ms[driverName]; ok {
+		return script, true
+	}
+	script, ok := ms[AnyDialect]
+	return script, ok
+}
+
+// Runs a statement under QueryTimeout of the database
+func (m *TMigrator) exec(ctx context.Context, ex tExecer, query string, args ...any) error {
+	ctx, cancel := m.db.withTimeout(ctx)
+	defer cancel()
+	_, err := ex.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m *TMigrator) ensureTable(ctx context.Context) error {
+	return m.exec(ctx, m.db, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at BIGINT NOT NULL)", m.Table))
+}
+
+// Returns migrations recorded in the schema table, ordered by version
+func (m *TMigrator) Applied() ([]TAppliedMigration, error) {
+	return m.AppliedCtx(context.Background())
+}
+
+func (m *TMigrator) AppliedCtx(ctx context.Context) ([]TAppliedMigration, error) {
+	err := m.ensureTable(ctx)
+	if err == nil {
+		rows, qerr := m.db.QueryDataCtx(ctx, fmt.Sprintf("SELECT version, name, applied_at FROM %s ORDER BY version", m.Table))
+		if qerr == nil {
+			defer rows.Close()
+			applied := make([]TAppliedMigration, 0)
+			for rows.Next() {
+				var (
+					am        TAppliedMigration
+					appliedAt int64
+				)
+				if serr := rows.Scan(&am.Version, &am.Name, &appliedAt); serr != nil {
+					return nil, serr
+				}
+				am.AppliedAt = time.Unix(appliedAt, 0)
+				applied = append(applied, am)
+			}
+			return applied, rows.Err()
+		}
+		return nil, qerr
+	}
+	return nil, err
+}
+
+// Returns highest applied version, 0 if none
+func (m *TMigrator) CurrentVersion() (int64, error) {
+	return m.CurrentVersionCtx(context.Background())
+}
+
+func (m *TMigrator) CurrentVersionCtx(ctx context.Context) (int64, error) {
+	applied, err := m.AppliedCtx(ctx)
+	if err == nil {
+		if len(applied) > 0 {
+			return applied[len(applied)-1].Version, nil
+		}
+		return 0, nil
+	}
+	return 0, err
+}
+
+// Applies all pending migrations
+func (m *TMigrator) Up() error {
+	return m.UpCtx(context.Background())
+}
+
+func (m *TMigrator) UpCtx(ctx context.Context) error {
+	var latest int64 = 0
+	for version := range m.migrations {
+		if version > latest {
+			latest = version
+		}
+	}
+	return m.MigrateToCtx(ctx, latest)
+}
+
+// Applies pending migrations up to target and rolls back applied ones above it
+func (m *TMigrator) MigrateTo(target int64) error {
+	return m.MigrateToCtx(context.Background(), target)
+}
+
+func (m *TMigrator) MigrateToCtx(ctx context.Context, target int64) error {
+	applied, err := m.AppliedCtx(ctx)
+	if err == nil {
+		isApplied := make(map[int64]bool)
+		for _, am := range applied {
+			isApplied[am.Version] = true
+		}
+		// roll back, newest first
+		for i := len(applied) - 1; i >= 0; i-- {
+			if applied[i].Version <= target {
+				break
+			}
+			mig, known := m.migrations[applied[i].Version]
+			if !known {
+				return fmt.Errorf("applied migration %d (%s) is not registered", applied[i].Version, applied[i].Name)
+			}
+			if derr := m.apply(ctx, mig, false); derr != nil {
+				return derr
+			}
+		}
+		// apply, oldest first
+		versions := make([]int64, 0, len(m.migrations))
+		for version := range m.migrations {
+			if version <= target && !isApplied[version] {
+				versions = append(versions, version)
+			}
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+		for _, version := range versions {
+			if uerr := m.apply(ctx, m.migrations[version], true); uerr != nil {
+				return uerr
+			}
+		}
+		return nil
+	}
+	return err
+}
+
+// Runs one migration step and records it in the schema table
+func (m *TMigrator) apply(ctx context.Context, mig TMigration, up bool) error {
+	dialect, derr := m.db.Dialect()
+	if derr != nil {
+		return derr
+	}
+	driverName := dialect.Name()
+	script, ok := mig.Down.forDriver(driverName)
+	if up {
+		script, ok = mig.Up.forDriver(driverName)
+	}
+	if !ok {
+		return fmt.Errorf("migration %d (%s) has no %s script for %s", mig.Version, mig.Name, directionName(up), driverName)
+	}
+	step := func(ex tExecer) error {
+		for _, stmt := range SplitDialectStatements(dialect, script) {
+			if err := m.exec(ctx, ex, stmt); err != nil {
+				return fmt.Errorf("migration %d (%s) %s failed: %w", mig.Version, mig.Name, directionName(up), err)
+			}
+		}
+		if up {
+			return m.exec(ctx, ex, fmt.Sprintf("INSERT INTO %s (version, name, applied_at) VALUES (?, ?, ?)", m.Table), mig.Version, mig.Name, time.Now().Unix())
+		}
+		return m.exec(ctx, ex, fmt.Sprintf("DELETE FROM %s WHERE version = ?", m.Table), mig.Version)
+	}
+	// MySQL commits implicitly on DDL, so a transaction would be of no use there
+	if !dialect.TransactionalDDL() {
+		return step(m.db)
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err == nil {
+		if serr := step(tx); serr != nil {
+			tx.Rollback()
+			return serr
+		}
+		return tx.Commit()
+	}
+	return err
+}
+
+func directionName(up bool) string {
+	if up {
+		return dirUp
+	}
+	return dirDown
+}
@@ -0,0 +1,146 @@
+package aegisql
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// Pool defaults for MySQL
+	defMySQLMaxOpen     = 16
+	defMySQLMaxIdle     = 4
+	defMySQLMaxLifetime = 30 * time.Minute
+	defMySQLMaxIdleTime = 5 * time.Minute
+	// Health check defaults
+	defHealthInterval = 30 * time.Second
+	defHealthTimeout  = 5 * time.Second
+)
+
+type (
+	// Connection pool settings, zero values mean no limit
+	TPoolConfig struct {
+		MaxOpenConns    int
+		MaxIdleConns    int
+		ConnMaxLifetime time.Duration
+		ConnMaxIdleTime time.Duration
+	}
+
+	// Snapshot of connection pool state
+	TPoolStats struct {
+		MaxOpen      int
+		Open         int
+		InUse        int
+		Idle         int
+		WaitCount    int64
+		WaitDuration time.Duration
+		ClosedIdle   int64 // closed due to MaxIdleConns
+		ClosedLife   int64 // closed due to ConnMaxLifetime or ConnMaxIdleTime
+	}
+
+	// Anything that logs events the way logmeow.TLogMeow does
+	TEventLogger interface {
+		LogEventInfo(edesc string)
+		LogEventWarning(edesc string)
+		LogEventError(edesc string)
+	}
+
+	// Called by the health checker after every ping, err is nil when the database is fine
+	THealthFunc func(err error, stats TPoolStats)
+)
+
+// Returns pool settings suited for the driver: SQLite allows a single writer at a time,
+// so it gets one connection, while MySQL gets a moderate pool with recycled connections.
+// With one SQLite connection, queries issued while iterating over open rows block until they are closed.
+func DefaultPoolConfig(driverName string) TPoolConfig {
+	switch driverName {
+	case DriverSQLite3:
+		// idle connection is kept forever, as losing the last one drops a shared in-memory database
+		return TPoolConfig{MaxOpenConns: 1, MaxIdleConns: 1}
+	case DriverMySQL:
+		return TPoolConfig{
+			MaxOpenConns:    defMySQLMaxOpen,
+			MaxIdleConns:    defMySQLMaxIdle,
+			ConnMaxLifetime: defMySQLMaxLifetime,
+			ConnMaxIdleTime: defMySQLMaxIdleTime,
+		}
+	default:
+		return TPoolConfig{}
+	}
+}
+
+// Applies pool settings to the database
+func (sqldb TAegiSQLDB) ConfigurePool(pc TPoolConfig) {
+	sqldb.SetMaxOpenConns(pc.MaxOpenConns)
+	sqldb.SetMaxIdleConns(pc.MaxIdleConns)
+	sqldb.SetConnMaxLifetime(pc.ConnMaxLifetime)
+	sqldb.SetConnMaxIdleTime(pc.ConnMaxIdleTime)
+}
+
+// Returns current pool state
+func (sqldb TAegiSQLDB) PoolStats() TPoolStats {
+	st := sqldb.Stats()
+	return TPoolStats{
+		MaxOpen:      st.MaxOpenConnections,
+		Open:         st.OpenConnections,
+		InUse:        st.InUse,
+		Idle:         st.Idle,
+		WaitCount:    st.WaitCount,
+		WaitDuration: st.WaitDuration,
+		ClosedIdle:   st.MaxIdleClosed,
+		ClosedLife:   st.MaxLifetimeClosed + st.MaxIdleTimeClosed,
+	}
+}
+
+// One-line description suitable for a log event
+func (ps TPoolStats) String() string {
+	maxOpen := "unlimited"
+	if ps.MaxOpen > 0 {
+		maxOpen = fmt.Sprintf("%d", ps.MaxOpen)
+	}
+	return fmt.Sprintf("db pool: open=%d/%s inuse=%d idle=%d waits=%d waited=%s closed(idle=%d life=%d)",
+		ps.Open, maxOpen, ps.InUse, ps.Idle, ps.WaitCount, ps.WaitDuration.Round(time.Millisecond), ps.ClosedIdle, ps.ClosedLife)
+}
+
+// Starts pinging the database every interval until ctx is done, reporting results to fn
+func (sqldb TAegiSQLDB) StartHealthCheck(ctx context.Context, interval time.Duration, fn THealthFunc) {
+	if interval <= 0 {
+		interval = defHealthInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pingCtx, cancel := context.WithTimeout(ctx, min(interval, defHealthTimeout))
+				err := sqldb.PingContext(pingCtx)
+				cancel()
+				if ctx.Err() != nil {
+					return
+				}
+				fn(err, sqldb.PoolStats())
+			}
+		}
+	}()
+}
+
+// Returns health callback logging failures as errors, recoveries as warnings and,
+// when verbose, every successful check as info
+func LogHealth(logger TEventLogger, verbose bool) THealthFunc {
+	failing := false
+	return func(err error, stats TPoolStats) {
+		switch {
+		case err != nil:
+			failing = true
+			logger.LogEventError(fmt.Sprintf("db health check failed: %v; %s", err, stats))
+		case failing:
+			failing = false
+			logger.LogEventWarning(fmt.Sprintf("db health restored; %s", stats))
+		case verbose:
+			logger.LogEventInfo(stats.String())
+		}
+	}
+}
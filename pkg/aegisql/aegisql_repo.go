@@ -0,0 +1,261 @@
+package aegisql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+const (
+	// Key column used when no field is tagged as pk
+	defRepoKeyColumn = "id"
+)
+
+type (
+	// Persists structs of type T in a table. Columns come from db tags (see QueryStructs);
+	// tag options mark special columns:
+	//
+	//	ID        int64      `db:"id,pk,auto"`            // primary key, auto means the database assigns it
+	//	Version   int64      `db:"version,version"`       // incremented on every save, guards against lost updates
+	//	DeletedAt *time.Time `db:"deleted_at,softdelete"` // set by Delete, such rows are hidden from queries
+	TRepo[T any] struct {
+		db          TAegiSQLDB
+		table       string
+		sm          *tStructMap
+		key         int // field numbers within sm.fields, -1 if absent
+		version     int
+		deleted     int
+		withDeleted bool
+	}
+)
+
+var (
+	// Returned when the row was changed by someone else since it was read
+	ErrStaleVersion = errors.New("row version is stale")
+	// Returned when the row does not exist or is deleted
+	ErrNotFound = errors.New("row not found")
+)
+
+// Returns repository of T kept in the table
+func NewRepo[T any](sqldb TAegiSQLDB, table string) (*TRepo[T], error) {
+	st := reflect.TypeOf((*T)(nil)).Elem()
+	sm, err := structMapOf(st)
+	if err != nil {
+		return nil, err
+	}
+	repo := &TRepo[T]{db: sqldb, table: table, sm: sm, key: -1, version: -1, deleted: -1}
+	for fi, fm := range sm.fields {
+		for _, special := range []struct {
+			option string
+			slot   *int
+		}{{optPK, &repo.key}, {optVersion, &repo.version}, {optSoftDelete, &repo.deleted}} {
+			if fm.hasOption(special.option) {
+				if *special.slot >= 0 {
+					return nil, fmt.Errorf("more than one field of %s is tagged %q", st, special.option)
+				}
+				*special.slot = fi
+			}
+		}
+	}
+	if repo.key < 0 {
+		if fi, ok := sm.byColumn[defRepoKeyColumn]; ok {
+			repo.key = fi
+		} else {
+			return nil, fmt.Errorf("%s has no primary key field, tag one with pk", st)
+		}
+	}
+	if repo.version >= 0 {
+		switch st.FieldByIndex(sm.fields[repo.version].index).Type.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+		default:
+			return nil, fmt.Errorf("version field of %s must be a signed integer", st)
+		}
+	}
+	if repo.deleted >= 0 {
+		switch st.FieldByIndex(sm.fields[repo.deleted].index).Type {
+		case reflect.TypeOf((*time.Time)(nil)), reflect.TypeOf(sql.NullTime{}):
+		default:
+			return nil, fmt.Errorf("softdelete field of %s must be *time.Time or sql.NullTime", st)
+		}
+	}
+	return repo, nil
+}
+
+// Returns view of the repository that also sees soft-deleted rows
+func (repo *TRepo[T]) WithDeleted() *TRepo[T] {
+	view := *repo
+	view.withDeleted = true
+	return &view
+}
+
+func (repo *TRepo[T]) column(fi int) string {
+	return repo.sm.fields[fi].column
+}
+
+func (repo *TRepo[T]) field(item *T, fi int) reflect.Value {
+	return fieldByIndexAlloc(reflect.ValueOf(item).Elem(), repo.sm.fields[fi].index)
+}
+
+// Conditions every query of the repository gets
+func (repo *TRepo[T]) scope() []TCond {
+	if repo.deleted >= 0 && !repo.withDeleted {
+		return []TCond{IsNull(repo.column(repo.deleted))}
+	}
+	return nil
+}
+
+// Returns SELECT of all mapped columns limited to live rows, to be refined and passed to Query
+func (repo *TRepo[T]) Select() *TSelectQuery {
+	columns := make([]string, len(repo.sm.fields))
+	for fi := range repo.sm.fields {
+		columns[fi] = repo.column(fi)
+	}
+	return Select(columns...).From(repo.table).Where(repo.scope()...)
+}
+
+// Runs query made by Select
+func (repo *TRepo[T]) Query(ctx context.Context, q *TSelectQuery) ([]T, error) {
+	query, args, err := repo.db.Build(q)
+	if err == nil {
+		return QueryStructsCtx[T](ctx, repo.db, query, args...)
+	}
+	return nil, err
+}
+
+// Returns rows matching all conditions
+func (repo *TRepo[T]) Find(ctx context.Context, conds ...TCond) ([]T, error) {
+	return repo.Query(ctx, repo.Select().Where(conds...))
+}
+
+// Returns row with the key, or ErrNotFound
+func (repo *TRepo[T]) Get(ctx context.Context, key any) (*T, error) {
+	items, err := repo.Query(ctx, repo.Select().Where(Eq(repo.column(repo.key), key)))
+	if err == nil {
+		if len(items) == 0 {
+			return nil, ErrNotFound
+		}
+		return &items[0], nil
+	}
+	return nil, err
+}
+
+// Inserts the item, filling in generated key and initial version
+func (repo *TRepo[T]) Insert(ctx context.Context, item *T) error {
+	auto := repo.sm.fields[repo.key].hasOption(optAuto)
+	if repo.version >= 0 {
+		repo.field(item, repo.version).SetInt(1)
+	}
+	columns := make([]string, 0, len(repo.sm.fields))
+	values := make([]any, 0, len(repo.sm.fields))
+	for fi := range repo.sm.fields {
+		value := repo.field(item, fi)
+		if fi == repo.key && auto && value.IsZero() {
+			continue
+		}
+		columns = append(columns, repo.column(fi))
+		values = append(values, value.Interface())
+	}
+	res, err := repo.db.QuerySingleBuiltCtx(ctx, Insert(repo.table).Columns(columns...).Values(values...))
+	if err == nil && auto && repo.field(item, repo.key).IsZero() {
+		id, ierr := res.LastInsertId()
+		if ierr != nil {
+			return ierr
+		}
+		key := repo.field(item, repo.key)
+		if key.CanInt() {
+			key.SetInt(id)
+		} else if key.CanUint() {
+			key.SetUint(uint64(id))
+		} else {
+			return fmt.Errorf("generated key cannot be stored in %s", key.Type())
+		}
+	}
+	return err
+}
+
+// Saves all fields of the item. With a version field the row must still have the version
+// the item was read with, otherwise ErrStaleVersion is returned; on success the version grows by one.
+func (repo *TRepo[T]) Update(ctx context.Context, item *T) error {
+	q := Update(repo.table)
+	for fi := range repo.sm.fields {
+		if fi != repo.key && fi != repo.version && fi != repo.deleted {
+			q.Set(repo.column(fi), repo.field(item, fi).Interface())
+		}
+	}
+	return repo.save(ctx, item, q)
+}
+
+// Soft-deletes the item when there is a softdelete field, otherwise removes its row.
+// The version is checked and bumped as with Update.
+func (repo *TRepo[T]) Delete(ctx context.Context, item *T) error {
+	if repo.deleted < 0 {
+		return repo.HardDelete(ctx, item)
+	}
+	now := time.Now().UTC()
+	deleted := repo.field(item, repo.deleted)
+	previous := reflect.ValueOf(deleted.Interface())
+	setTime(deleted, now)
+	err := repo.save(ctx, item, Update(repo.table).Set(repo.column(repo.deleted), now))
+	if err != nil {
+		deleted.Set(previous)
+	}
+	return err
+}
+
+// Removes the row of the item for good, checking its version if there is one
+func (repo *TRepo[T]) HardDelete(ctx context.Context, item *T) error {
+	q := Delete(repo.table).Where(Eq(repo.column(repo.key), repo.field(item, repo.key).Interface()))
+	if repo.version >= 0 {
+		q.Where(Eq(repo.column(repo.version), repo.field(item, repo.version).Interface()))
+	}
+	res, err := repo.db.QuerySingleBuiltCtx(ctx, q)
+	if err == nil {
+		return repo.checkAffected(ctx, item, res)
+	}
+	return err
+}
+
+// Runs UPDATE of the item row guarded by its version
+func (repo *TRepo[T]) save(ctx context.Context, item *T, q *TUpdateQuery) error {
+	q.Where(Eq(repo.column(repo.key), repo.field(item, repo.key).Interface()))
+	q.Where(repo.scope()...)
+	var version reflect.Value
+	if repo.version >= 0 {
+		version = repo.field(item, repo.version)
+		q.Set(repo.column(repo.version), version.Int()+1)
+		q.Where(Eq(repo.column(repo.version), version.Interface()))
+	}
+	res, err := repo.db.QuerySingleBuiltCtx(ctx, q)
+	if err == nil {
+		if err = repo.checkAffected(ctx, item, res); err == nil && version.IsValid() {
+			version.SetInt(version.Int() + 1)
+		}
+	}
+	return err
+}
+
+// Tells why no row was affected: the row is gone, or its version moved on
+func (repo *TRepo[T]) checkAffected(ctx context.Context, item *T, res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+	_, err = repo.Get(ctx, repo.field(item, repo.key).Interface())
+	if err == nil && repo.version >= 0 {
+		return ErrStaleVersion
+	}
+	// without a version the row is fine, MySQL just does not count rows left unchanged
+	return err
+}
+
+// Stores time into *time.Time or sql.NullTime field
+func setTime(field reflect.Value, t time.Time) {
+	if _, ok := field.Interface().(sql.NullTime); ok {
+		field.Set(reflect.ValueOf(sql.NullTime{Time: t, Valid: true}))
+	} else {
+		field.Set(reflect.ValueOf(&t))
+	}
+}
@@ -0,0 +1,218 @@
+package aegisql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	// Struct tag used for column mapping
+	tagDB   = "db"
+	tagSkip = "-"
+	// Tag options understood by TRepo
+	optPK         = "pk"         // primary key column
+	optAuto       = "auto"       // key generated by the database on insert
+	optVersion    = "version"    // row version for optimistic locking
+	optSoftDelete = "softdelete" // deletion time, NULL for live rows
+)
+
+type (
+	// Defines a single struct field mapped onto a column
+	tFieldMap struct {
+		column  string
+		index   []int
+		tagged  bool
+		options []string
+	}
+
+	// Defines how a struct type is mapped onto columns
+	tStructMap struct {
+		fields   []tFieldMap
+		byColumn map[string]int
+	}
+)
+
+func (fm tFieldMap) hasOption(option string) bool {
+	for _, o := range fm.options {
+		if strings.TrimSpace(o) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Cache of struct maps (reflect.Type -> *tStructMap)
+var structMaps sync.Map
+
+// Returns (possibly cached) column mapping for a struct type
+func structMapOf(st reflect.Type) (*tStructMap, error) {
+	if st.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", st)
+	}
+	if cached, ok := structMaps.Load(st); ok {
+		return cached.(*tStructMap), nil
+	}
+	sm := &tStructMap{byColumn: make(map[string]int)}
+	if err := sm.collect(st, nil); err != nil {
+		return nil, err
+	}
+	structMaps.Store(st, sm)
+	return sm, nil
+}
+
+func (sm *tStructMap) collect(st reflect.Type, parent []int) error {
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Field(i)
+		index := append(append([]int{}, parent...), i)
+		tag, tagged := field.Tag.Lookup(tagDB)
+		if tag == tagSkip {
+			continue
+		}
+		// flatten untagged embedded structs
+		if field.Anonymous && !tagged {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				if !field.IsExported() {
+					continue
+				}
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if err := sm.collect(ft, index); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		fm := tFieldMap{column: field.Name, index: index, tagged: tagged}
+		if tagged {
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				fm.column = parts[0]
+			}
+			fm.options = parts[1:]
+		}
+		key := strings.ToLower(fm.column)
+		if _, dup := sm.byColumn[key]; dup {
+			return fmt.Errorf("column %q is mapped more than once in %s", fm.column, st)
+		}
+		sm.byColumn[key] = len(sm.fields)
+		sm.fields = append(sm.fields, fm)
+	}
+	return nil
+}
+
+// Matches result columns against struct fields, returning field index for every column
+func (sm *tStructMap) matchColumns(st reflect.Type, columns []string) ([]int, error) {
+	matched := make([]int, len(columns))
+	used := make([]bool, len(sm.fields))
+	for c, column := range columns {
+		fi, ok := sm.byColumn[strings.ToLower(column)]
+		if !ok {
+			return nil, fmt.Errorf("column %q has no matching field in %s", column, st)
+		}
+		matched[c] = fi
+		used[fi] = true
+	}
+	// explicitly tagged fields are expected to be present in the result
+	for fi, fm := range sm.fields {
+		if fm.tagged && !used[fi] {
+			return nil, fmt.Errorf("field %s.%s has no matching column %q", st, st.FieldByIndex(fm.index).Name, fm.column)
+		}
+	}
+	return matched, nil
+}
+
+// Returns addressable field, allocating nil embedded struct pointers on the way
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// Scans current row into dest, which must be a pointer to struct
+func (rows TAegiSQLRows) scanStruct(dest any) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer to struct, got %T", dest)
+	}
+	sv := dv.Elem()
+	sm, err := structMapOf(sv.Type())
+	if err == nil {
+		columns, cerr := rows.Columns()
+		if cerr == nil {
+			matched, merr := sm.matchColumns(sv.Type(), columns)
+			if merr == nil {
+				pointers := make([]any, len(columns))
+				for c := range columns {
+					// sql.Null* and pointer fields are handled by database/sql itself
+					pointers[c] = fieldByIndexAlloc(sv, sm.fields[matched[c]].index).Addr().Interface()
+				}
+				return rows.Scan(pointers...)
+			}
+			return merr
+		}
+		return cerr
+	}
+	return err
+}
+
+// Scans next row into a new T, returns nil at the end of rows
+func UnloadInto[T any](rows TAegiSQLRows) (*T, error) {
+	return UnloadIntoCtx[T](context.Background(), rows)
+}
+
+func UnloadIntoCtx[T any](ctx context.Context, rows TAegiSQLRows) (*T, error) {
+	err := rows.advance(ctx)
+	if err == nil {
+		dest := new(T)
+		serr := rows.scanStruct(dest)
+		if serr == nil {
+			return dest, nil
+		}
+		return nil, serr
+	}
+	if errors.Is(err, ErrNoMoreRows) {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// Runs a query and scans all resulting rows into a slice of T
+func QueryStructs[T any](sqldb TAegiSQLDB, query string, args ...any) ([]T, error) {
+	return QueryStructsCtx[T](context.Background(), sqldb, query, args...)
+}
+
+func QueryStructsCtx[T any](ctx context.Context, sqldb TAegiSQLDB, query string, args ...any) ([]T, error) {
+	rows, err := sqldb.QueryDataCtx(ctx, query, args...)
+	if err == nil {
+		defer rows.Close()
+		result := make([]T, 0)
+		for {
+			item, uerr := UnloadIntoCtx[T](ctx, rows)
+			if uerr != nil {
+				return nil, uerr
+			}
+			if item == nil {
+				break
+			}
+			result = append(result, *item)
+		}
+		return result, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,219 @@
+package aegisql
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Comment states of the splitter
+	inCode = iota
+	inLineComment
+	inBlockComment
+)
+
+type (
+	// Splits SQL text into statements on semicolons outside of quotes and comments, one rune at a time
+	tSplitter struct {
+		current   strings.Builder
+		quote     rune // closing quote we are waiting for
+		held      rune // '-' or '/' that may start a comment
+		prev      rune
+		comment   int
+		word      strings.Builder // keyword or name being read
+		words     int             // words of the statement so far
+		create    bool            // statement is CREATE and TRIGGER may still follow
+		trigger   bool            // statement is CREATE [TEMP] TRIGGER
+		depth     int             // BEGIN and CASE blocks of the trigger not closed by END yet
+		afterEnd  bool            // the last word was END that closed a block
+		backslash bool            // backslash escapes the next character within quotes (MySQL)
+		escaped   bool            // previous rune was such a backslash
+	}
+)
+
+var (
+	// Words that may stand between CREATE and TRIGGER
+	triggerHeadWords = map[string]bool{"TEMP": true, "TEMPORARY": true, "DEFINER": true, "CURRENT_USER": true, "OR": true, "REPLACE": true}
+	// Compound statements of MySQL closed by END IF, END LOOP and so on
+	endQualifiers = map[string]bool{"IF": true, "LOOP": true, "WHILE": true, "REPEAT": true}
+)
+
+// Feeds next rune, returns a statement when one is complete
+func (sp *tSplitter) feed(r rune) (string, bool) {
+	switch sp.comment {
+	case inLineComment:
+		if r == '\n' {
+			sp.comment = inCode
+			sp.current.WriteRune(r)
+		}
+		return "", false
+	case inBlockComment:
+		if sp.prev == '*' && r == '/' {
+			sp.comment = inCode
+			r = 0
+		}
+		sp.prev = r
+		return "", false
+	}
+	if sp.quote != 0 {
+		sp.current.WriteRune(r)
+		switch {
+		case sp.escaped:
+			sp.escaped = false
+		case r == '\\' && sp.backslash && (sp.quote == '\'' || sp.quote == '"'):
+			sp.escaped = true
+		case r == sp.quote:
+			sp.quote = 0
+		}
+		return "", false
+	}
+	if sp.held != 0 {
+		held := sp.held
+		sp.held = 0
+		switch {
+		// a comment separates tokens like whitespace does
+		case held == '-' && r == '-':
+			sp.comment = inLineComment
+			sp.current.WriteRune(' ')
+			return "", false
+		case held == '/' && r == '*':
+			sp.comment = inBlockComment
+			sp.current.WriteRune(' ')
+			sp.prev = 0
+			return "", false
+		}
+		sp.current.WriteRune(held)
+	}
+	if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+		sp.word.WriteRune(r)
+		sp.current.WriteRune(r)
+		return "", false
+	}
+	sp.endWord()
+	switch r {
+	case '-', '/':
+		sp.held = r
+	case '\'', '"', '`':
+		sp.quote = r
+		sp.current.WriteRune(r)
+	case '[':
+		sp.quote = ']'
+		sp.current.WriteRune(r)
+	case ';':
+		if sp.trigger && sp.depth > 0 {
+			sp.current.WriteRune(r)
+		} else {
+			return sp.flush()
+		}
+	default:
+		sp.current.WriteRune(r)
+	}
+	return "", false
+}
+
+// Returns whatever is left after the last semicolon
+func (sp *tSplitter) finish() (string, bool) {
+	if sp.held != 0 && sp.comment == inCode {
+		sp.current.WriteRune(sp.held)
+		sp.held = 0
+	}
+	return sp.flush()
+}
+
+func (sp *tSplitter) flush() (string, bool) {
+	stmt := strings.TrimSpace(sp.current.String())
+	sp.current.Reset()
+	sp.word.Reset()
+	sp.words, sp.create, sp.trigger, sp.depth, sp.afterEnd = 0, false, false, 0, false
+	return stmt, stmt != ""
+}
+
+// Takes account of the word just read. Semicolons within the body of CREATE TRIGGER ... BEGIN ... END
+// do not end the statement, and CASE ... END expressions inside the body must not close it early.
+func (sp *tSplitter) endWord() {
+	word := strings.ToUpper(sp.word.String())
+	sp.word.Reset()
+	if word == "" {
+		return
+	}
+	sp.words++
+	afterEnd := sp.afterEnd
+	sp.afterEnd = false
+	switch {
+	case sp.words == 1:
+		sp.create = word == "CREATE"
+	case sp.create && word == "TRIGGER":
+		sp.create, sp.trigger = false, true
+	case sp.create:
+		sp.create = triggerHeadWords[word]
+	case !sp.trigger:
+	case afterEnd && endQualifiers[word]:
+		// END IF and the like close a compound statement that was never counted, so that END did not count either
+		sp.depth++
+	case afterEnd && word == "CASE":
+		// END CASE closes the CASE counted before, this CASE opens nothing
+	case word == "BEGIN" || word == "CASE":
+		sp.depth++
+	case word == "END" && sp.depth > 0:
+		sp.depth--
+		sp.afterEnd = true
+	}
+}
+
+// Splits SQL script into separate statements on semicolons outside of quotes and comments.
+// Quotes are escaped by doubling them, as in standard SQL and SQLite.
+func SplitStatements(script string) []string {
+	return splitStatements(&tSplitter{}, script)
+}
+
+// Splits SQL script like SplitStatements, following string escapes of the dialect
+func SplitDialectStatements(d TDialect, script string) []string {
+	return splitStatements(&tSplitter{backslash: d.BackslashEscapes()}, script)
+}
+
+func splitStatements(sp *tSplitter, script string) []string {
+	var stmts []string
+	for _, r := range script {
+		if stmt, ok := sp.feed(r); ok {
+			stmts = append(stmts, stmt)
+		}
+	}
+	if stmt, ok := sp.finish(); ok {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+// Reads statements from a stream one by one, calling fn for each
+func ScanStatements(r io.Reader, fn func(stmt string) error) error {
+	return scanStatements(&tSplitter{}, r, fn)
+}
+
+// Reads statements like ScanStatements, following string escapes of the dialect
+func ScanDialectStatements(d TDialect, r io.Reader, fn func(stmt string) error) error {
+	return scanStatements(&tSplitter{backslash: d.BackslashEscapes()}, r, fn)
+}
+
+func scanStatements(sp *tSplitter, r io.Reader, fn func(stmt string) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		ch, _, err := reader.ReadRune()
+		if errors.Is(err, io.EOF) {
+			if stmt, ok := sp.finish(); ok {
+				return fn(stmt)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if stmt, ok := sp.feed(ch); ok {
+			if ferr := fn(stmt); ferr != nil {
+				return ferr
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package aegisql_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/UrsusArctos/dkit/pkg/aegisql"
+	"github.com/UrsusArctos/dkit/pkg/aegisql/aegisqltest"
+)
+
+const triggerWithCase = `CREATE TABLE t (id INTEGER PRIMARY KEY, a INTEGER, x INTEGER);
+CREATE TRIGGER t_x AFTER INSERT ON t BEGIN
+	UPDATE t SET x = CASE WHEN NEW.a > 0 THEN 1 ELSE 2 END WHERE id = NEW.id;
+	UPDATE t SET x = x * 10 WHERE id = NEW.id;
+END;
+INSERT INTO t (id, a) VALUES (1, 5), (2, -5)`
+
+func TestSplitStatements(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"plain", "SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"quoted semicolon", "INSERT INTO t VALUES ('a;b'); SELECT \"c;d\"", []string{"INSERT INTO t VALUES ('a;b')", `SELECT "c;d"`}},
+		{"block comment", "SELECT/*x*/2;SELECT 3/**/+1", []string{"SELECT 2", "SELECT 3 +1"}},
+		{"line comment", "SELECT--x\n2; -- done", []string{"SELECT \n2"}},
+		{"comment hides semicolon", "SELECT 1 /* ; */; SELECT 2 -- ;\n", []string{"SELECT 1", "SELECT 2"}},
+		{"minus and slash", "SELECT 4-1; SELECT 4/2", []string{"SELECT 4-1", "SELECT 4/2"}},
+		{"transaction", "BEGIN; INSERT INTO t VALUES (1); END", []string{"BEGIN", "INSERT INTO t VALUES (1)", "END"}},
+		{"trigger", "CREATE TEMP TRIGGER tr AFTER DELETE ON t BEGIN DELETE FROM u; DELETE FROM v; END; SELECT 1", []string{
+			"CREATE TEMP TRIGGER tr AFTER DELETE ON t BEGIN DELETE FROM u; DELETE FROM v; END",
+			"SELECT 1",
+		}},
+	} {
+		if got := aegisql.SplitStatements(tc.script); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\n  want: %q\n  got:  %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestSplitTriggerWithCase(t *testing.T) {
+	stmts := aegisql.SplitStatements(triggerWithCase)
+	if len(stmts) != 3 || !strings.HasSuffix(stmts[1], "END") {
+		t.Fatalf("trigger split wrongly into %d statements: %q", len(stmts), stmts)
+	}
+	var scanned []string
+	err := aegisql.ScanStatements(strings.NewReader(triggerWithCase), func(stmt string) error {
+		scanned = append(scanned, stmt)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(scanned, stmts) {
+		t.Errorf("ScanStatements differs from SplitStatements: %q, %v", scanned, err)
+	}
+}
+
+func TestMigrateTriggerWithCase(t *testing.T) {
+	db := aegisqltest.NewDB(t, aegisqltest.TFixture{Migrations: []aegisql.TMigration{{
+		Version: 1,
+		Name:    "trigger",
+		Up:      aegisql.TMigrationScript{aegisql.AnyDialect: triggerWithCase},
+	}}})
+	aegisqltest.GoldenQuery(t, db, "migrate_trigger_case", "SELECT id, x FROM t ORDER BY id")
+}
+
+func TestSplitMySQLTrigger(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+	}{
+		{"if", "IF NEW.a > 0 THEN SET NEW.x = 1; ELSE SET NEW.x = 2; END IF; SET NEW.a = 0;"},
+		{"case", "CASE WHEN NEW.a > 0 THEN SET NEW.x = 1; ELSE SET NEW.x = 2; END CASE; SET NEW.a = 0;"},
+		{"loop", "l: LOOP SET NEW.x = NEW.x + 1; IF NEW.x > 9 THEN LEAVE l; END IF; END LOOP; SET NEW.a = 0;"},
+		{"while", "WHILE NEW.x < 9 DO SET NEW.x = NEW.x + 1; END WHILE; SET NEW.a = 0;"},
+		{"repeat", "REPEAT SET NEW.x = NEW.x + 1; UNTIL NEW.x > 9 END REPEAT; SET NEW.a = 0;"},
+		{"nested", "BEGIN IF NEW.a > 0 THEN SET NEW.x = CASE NEW.a WHEN 1 THEN 1 ELSE 2 END; END IF; END; SET NEW.a = 0;"},
+	} {
+		trigger := "CREATE DEFINER=CURRENT_USER TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN " + tc.body + " END"
+		want := []string{trigger, "SELECT 1"}
+		if got := aegisql.SplitDialectStatements(aegisql.TMySQLDialect{}, trigger+"; SELECT 1;"); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\n  want: %q\n  got:  %q", tc.name, want, got)
+		}
+	}
+}
+
+func TestSplitBackslashEscapes(t *testing.T) {
+	script := `INSERT INTO t VALUES ('it\'s; here', "a\"; b", 'c\\'); SELECT 1`
+	want := []string{`INSERT INTO t VALUES ('it\'s; here', "a\"; b", 'c\\')`, "SELECT 1"}
+	if got := aegisql.SplitDialectStatements(aegisql.TMySQLDialect{}, script); !reflect.DeepEqual(got, want) {
+		t.Errorf("MySQL:\n  want: %q\n  got:  %q", want, got)
+	}
+	var scanned []string
+	err := aegisql.ScanDialectStatements(aegisql.TMySQLDialect{}, strings.NewReader(script), func(stmt string) error {
+		scanned = append(scanned, stmt)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(scanned, want) {
+		t.Errorf("ScanDialectStatements: want %q, got %q, %v", want, scanned, err)
+	}
+	// a backslash is an ordinary character in SQLite, where 'c\' ends the literal
+	if got := aegisql.SplitDialectStatements(aegisql.TSQLiteDialect{}, `SELECT 'c\'; SELECT 2`); len(got) != 2 {
+		t.Errorf("SQLite: want 2 statements, got %q", got)
+	}
+}
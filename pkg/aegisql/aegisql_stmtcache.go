@@ -0,0 +1,160 @@
+package aegisql
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// Capacity used when NewStmtCache is given a non-positive one
+	defStmtCacheCapacity = 64
+)
+
+type (
+	// LRU cache of prepared statements keyed by query text, one per database
+	TStmtCache struct {
+		mu       sync.Mutex
+		capacity int
+		order    *list.List // front is the most recently used
+		entries  map[string]*list.Element
+		stats    TStmtCacheStats
+	}
+
+	// Counters of statement cache activity
+	TStmtCacheStats struct {
+		Hits          uint64
+		Misses        uint64
+		Evictions     uint64 // dropped to stay within capacity
+		Invalidations uint64 // dropped after connection errors
+		Size          int
+		Capacity      int
+	}
+
+	tStmtEntry struct {
+		query   string
+		stmt    *sql.Stmt
+		refs    int  // number of callers currently using stmt
+		evicted bool // stmt is to be closed once refs drop to zero
+	}
+)
+
+func NewStmtCache(capacity int) *TStmtCache {
+	if capacity <= 0 {
+		capacity = defStmtCacheCapacity
+	}
+	return &TStmtCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Returns prepared statement for the query and a function to call when done with it
+func (sc *TStmtCache) acquire(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, func(err error), error) {
+	sc.mu.Lock()
+	if elem, ok := sc.entries[query]; ok {
+		entry := elem.Value.(*tStmtEntry)
+		entry.refs++
+		sc.order.MoveToFront(elem)
+		sc.stats.Hits++
+		sc.mu.Unlock()
+		return entry.stmt, sc.releaser(entry), nil
+	}
+	sc.stats.Misses++
+	sc.mu.Unlock()
+	// prepare outside of the lock, it takes a round trip
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if elem, ok := sc.entries[query]; ok {
+		// somebody else has prepared it meanwhile
+		stmt.Close()
+		entry := elem.Value.(*tStmtEntry)
+		entry.refs++
+		sc.order.MoveToFront(elem)
+		return entry.stmt, sc.releaser(entry), nil
+	}
+	entry := &tStmtEntry{query: query, stmt: stmt, refs: 1}
+	sc.entries[query] = sc.order.PushFront(entry)
+	for sc.order.Len() > sc.capacity {
+		sc.drop(sc.order.Back())
+		sc.stats.Evictions++
+	}
+	return stmt, sc.releaser(entry), nil
+}
+
+func (sc *TStmtCache) releaser(entry *tStmtEntry) func(err error) {
+	return func(err error) {
+		sc.mu.Lock()
+		defer sc.mu.Unlock()
+		entry.refs--
+		if isConnError(err) && !entry.evicted {
+			sc.drop(sc.entries[entry.query])
+			sc.stats.Invalidations++
+		}
+		if entry.evicted && entry.refs == 0 {
+			entry.stmt.Close()
+		}
+	}
+}
+
+// Removes element from the cache, closing its statement if nobody uses it (must be called locked)
+func (sc *TStmtCache) drop(elem *list.Element) {
+	entry := elem.Value.(*tStmtEntry)
+	sc.order.Remove(elem)
+	delete(sc.entries, entry.query)
+	entry.evicted = true
+	if entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// Returns snapshot of cache counters
+func (sc *TStmtCache) Stats() TStmtCacheStats {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	stats := sc.stats
+	stats.Size = sc.order.Len()
+	stats.Capacity = sc.capacity
+	return stats
+}
+
+// Drops all cached statements
+func (sc *TStmtCache) Purge() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for sc.order.Len() > 0 {
+		sc.drop(sc.order.Back())
+	}
+}
+
+func (stats TStmtCacheStats) String() string {
+	ratio := 0.0
+	if stats.Hits+stats.Misses > 0 {
+		ratio = float64(stats.Hits) * 100 / float64(stats.Hits+stats.Misses)
+	}
+	return fmt.Sprintf("stmt cache %d/%d: hits=%d misses=%d (%.1f%% hit) evictions=%d invalidations=%d",
+		stats.Size, stats.Capacity, stats.Hits, stats.Misses, ratio, stats.Evictions, stats.Invalidations)
+}
+
+// Tells if the error means the connection behind a statement is gone
+func isConnError(err error) bool {
+	var netErr net.Error
+	return err != nil && (errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr))
+}
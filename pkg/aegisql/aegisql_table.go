@@ -0,0 +1,162 @@
+package aegisql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// MySQL error "Duplicate key name"
+	mysqlErrDupKeyName = 1061
+)
+
+type (
+	// Defines a single table column
+	TColumnDef struct {
+		Name     string
+		Kind     TColumnKind
+		Size     int
+		Nullable bool
+		Unique   bool
+		Default  string // SQL expression, used as is
+		autoPK   bool
+	}
+
+	// Defines a table, renders DDL for a given dialect
+	TTableDef struct {
+		Name       string
+		Columns    []TColumnDef
+		PrimaryKey []string
+		Indexes    map[string][]string
+	}
+
+	// Adjusts column definition
+	TColumnOption func(col *TColumnDef)
+)
+
+func NewTable(name string) *TTableDef {
+	return &TTableDef{Name: name, Indexes: make(map[string][]string)}
+}
+
+// Column options
+
+func Size(size int) TColumnOption {
+	return func(col *TColumnDef) { col.Size = size }
+}
+
+func Nullable() TColumnOption {
+	return func(col *TColumnDef) { col.Nullable = true }
+}
+
+func Unique() TColumnOption {
+	return func(col *TColumnDef) { col.Unique = true }
+}
+
+func Default(expr string) TColumnOption {
+	return func(col *TColumnDef) { col.Default = expr }
+}
+
+// Adds autoincrement integer primary key column
+func (td *TTableDef) AutoID(name string) *TTableDef {
+	td.Columns = append(td.Columns, TColumnDef{Name: name, Kind: KindBigInt, autoPK: true})
+	return td
+}
+
+// Adds column, which is NOT NULL unless Nullable() is given
+func (td *TTableDef) Column(name string, kind TColumnKind, opts ...TColumnOption) *TTableDef {
+	col := TColumnDef{Name: name, Kind: kind}
+	for _, opt := range opts {
+		opt(&col)
+	}
+	td.Columns = append(td.Columns, col)
+	return td
+}
+
+// Sets (possibly composite) primary key, not to be combined with AutoID
+func (td *TTableDef) Key(columns ...string) *TTableDef {
+	td.PrimaryKey = columns
+	return td
+}
+
+// Adds non-unique index
+func (td *TTableDef) Index(name string, columns ...string) *TTableDef {
+	td.Indexes[name] = columns
+	return td
+}
+
+// Returns CREATE TABLE IF NOT EXISTS statement followed by CREATE INDEX statements
+func (td TTableDef) CreateSQL(d TDialect) []string {
+	defs := make([]string, 0, len(td.Columns)+1)
+	for _, col := range td.Columns {
+		if col.autoPK {
+			defs = append(defs, d.AutoIncrementPK(col.Name))
+			continue
+		}
+		def := fmt.Sprintf("%s %s", d.QuoteIdent(col.Name), d.ColumnType(col.Kind, col.Size))
+		if col.Nullable {
+			def += " NULL"
+		} else {
+			def += " NOT NULL"
+		}
+		if col.Default != "" {
+			def += " DEFAULT " + col.Default
+		}
+		if col.Unique {
+			def += " UNIQUE"
+		}
+		defs = append(defs, def)
+	}
+	if len(td.PrimaryKey) > 0 {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", quoteList(d, td.PrimaryKey)))
+	}
+	stmts := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", d.QuoteIdent(td.Name), strings.Join(defs, ", "))}
+	names := make([]string, 0, len(td.Indexes))
+	for name := range td.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stmts = append(stmts, createIndexSQL(d, td.Name, name, td.Indexes[name]))
+	}
+	return stmts
+}
+
+// Returns DROP TABLE IF EXISTS statement
+func (td TTableDef) DropSQL(d TDialect) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", d.QuoteIdent(td.Name))
+}
+
+func createIndexSQL(d TDialect, table string, name string, columns []string) string {
+	// MySQL has no IF NOT EXISTS for indexes
+	ifNotExists := ""
+	if d.Name() == DriverSQLite3 {
+		ifNotExists = "IF NOT EXISTS "
+	}
+	return fmt.Sprintf("CREATE INDEX %s%s ON %s (%s)", ifNotExists, d.QuoteIdent(name), d.QuoteIdent(table), quoteList(d, columns))
+}
+
+// Creates the table (and its indexes) in the database
+func (sqldb TAegiSQLDB) CreateTable(td *TTableDef) error {
+	return sqldb.CreateTableCtx(context.Background(), td)
+}
+
+func (sqldb TAegiSQLDB) CreateTableCtx(ctx context.Context, td *TTableDef) error {
+	d, err := sqldb.Dialect()
+	if err == nil {
+		for _, stmt := range td.CreateSQL(d) {
+			_, eerr := sqldb.QuerySingleCtx(ctx, stmt)
+			// existing index is fine for MySQL, which cannot check for it in advance
+			var myerr *mysql.MySQLError
+			if eerr != nil && !(errors.As(eerr, &myerr) && myerr.Number == mysqlErrDupKeyName) {
+				return eerr
+			}
+		}
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package aegisql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/UrsusArctos/dkit/pkg/aegisql"
+	"github.com/UrsusArctos/dkit/pkg/aegisql/aegisqltest"
+)
+
+type (
+	// Driver answering every query with fixed rows, declared like MySQL declares DATETIME columns
+	tTextDateDriver struct{ rows [][]driver.Value }
+	tTextDateConn   struct{ rows [][]driver.Value }
+	tTextDateStmt   struct{ rows [][]driver.Value }
+	tTextDateRows   struct{ rows [][]driver.Value }
+)
+
+func (d tTextDateDriver) Connect(context.Context) (driver.Conn, error) { return tTextDateConn(d), nil }
+func (d tTextDateDriver) Driver() driver.Driver                        { return nil }
+
+func (c tTextDateConn) Prepare(string) (driver.Stmt, error) { return tTextDateStmt(c), nil }
+func (c tTextDateConn) Close() error                        { return nil }
+func (c tTextDateConn) Begin() (driver.Tx, error)           { return nil, errors.New("read only") }
+
+func (s tTextDateStmt) Close() error  { return nil }
+func (s tTextDateStmt) NumInput() int { return -1 }
+func (s tTextDateStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("read only")
+}
+func (s tTextDateStmt) Query([]driver.Value) (driver.Rows, error) { return &tTextDateRows{s.rows}, nil }
+
+func (r *tTextDateRows) Columns() []string                   { return []string{"at"} }
+func (r *tTextDateRows) Close() error                        { return nil }
+func (r *tTextDateRows) ColumnTypeScanType(int) reflect.Type { return reflect.TypeOf(sql.NullTime{}) }
+
+func (r *tTextDateRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// Collects column at of every row
+func unloadDates(t *testing.T, db aegisql.TAegiSQLDB, query string) []any {
+	t.Helper()
+	rows, err := db.QueryData(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var dates []any
+	for {
+		row, uerr := rows.UnloadNextTypedRow()
+		if errors.Is(uerr, aegisql.ErrNoMoreRows) {
+			return dates
+		}
+		if uerr != nil {
+			t.Fatal(uerr)
+		}
+		dates = append(dates, row["at"])
+	}
+}
+
+func TestTypedRowsDates(t *testing.T) {
+	db := aegisqltest.NewDB(t, aegisqltest.TFixture{Seed: []string{
+		"CREATE TABLE d (id INTEGER PRIMARY KEY, at DATETIME); INSERT INTO d VALUES (1, '2024-01-02 03:04:05'), (2, NULL)",
+	}})
+	want := []any{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), nil}
+	if got := unloadDates(t, db, "SELECT at FROM d ORDER BY id"); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestTypedRowsUnparsedDates(t *testing.T) {
+	// MySQL without parseTime=true declares sql.NullTime but delivers text
+	db := aegisql.TAegiSQLDB{DB: sql.OpenDB(tTextDateDriver{rows: [][]driver.Value{{[]byte("2024-01-02 03:04:05")}, {nil}}})}
+	defer db.Close()
+	want := []any{"2024-01-02 03:04:05", nil}
+	if got := unloadDates(t, db, "SELECT at FROM d"); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %#v, got %#v", want, got)
+	}
+}
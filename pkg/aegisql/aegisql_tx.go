@@ -0,0 +1,105 @@
+package aegisql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// MySQL lock errors worth retrying
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+	// Retry defaults
+	defRetryAttempts   = 5
+	defRetryBackoff    = 10 * time.Millisecond
+	defRetryMaxBackoff = time.Second
+)
+
+type (
+	// Defines how transactions failed on lock contention are retried
+	TRetryPolicy struct {
+		MaxAttempts    int           // including the first one, 0 means default
+		InitialBackoff time.Duration // doubled on every attempt, 0 means default
+		MaxBackoff     time.Duration // 0 means default
+	}
+
+	// Transaction body
+	TTxFunc func(tx *sql.Tx) error
+)
+
+// Tells if the error is a transient lock conflict (SQLITE_BUSY, SQLITE_LOCKED, MySQL deadlock or lock wait timeout)
+func IsRetryable(err error) bool {
+	var (
+		liteErr sqlite3.Error
+		myErr   *mysql.MySQLError
+	)
+	if errors.As(err, &liteErr) {
+		return liteErr.Code == sqlite3.ErrBusy || liteErr.Code == sqlite3.ErrLocked
+	}
+	if errors.As(err, &myErr) {
+		return myErr.Number == mysqlErrDeadlock || myErr.Number == mysqlErrLockWaitTimeout
+	}
+	return false
+}
+
+func (rp TRetryPolicy) withDefaults() TRetryPolicy {
+	if rp.MaxAttempts <= 0 {
+		rp.MaxAttempts = defRetryAttempts
+	}
+	if rp.InitialBackoff <= 0 {
+		rp.InitialBackoff = defRetryBackoff
+	}
+	if rp.MaxBackoff <= 0 {
+		rp.MaxBackoff = defRetryMaxBackoff
+	}
+	return rp
+}
+
+// Returns delay before the given (1-based) retry, with jitter
+func (rp TRetryPolicy) backoff(retry int) time.Duration {
+	delay := rp.InitialBackoff << (retry - 1)
+	if delay > rp.MaxBackoff || delay <= 0 {
+		delay = rp.MaxBackoff
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// Runs fn in a transaction, commits on success and rolls back on error or panic.
+// The whole fn is run again when the transaction fails on lock contention, so it must not have side effects outside tx.
+func (sqldb TAegiSQLDB) WithTx(ctx context.Context, opts *sql.TxOptions, fn TTxFunc) error {
+	policy := sqldb.RetryPolicy.withDefaults()
+	for attempt := 1; ; attempt++ {
+		err := sqldb.runTx(ctx, opts, fn)
+		if err == nil || !IsRetryable(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(policy.backoff(attempt)):
+		}
+	}
+}
+
+func (sqldb TAegiSQLDB) runTx(ctx context.Context, opts *sql.TxOptions, fn TTxFunc) (err error) {
+	tx, err := sqldb.BeginTx(ctx, opts)
+	if err == nil {
+		defer func() {
+			if p := recover(); p != nil {
+				tx.Rollback()
+				panic(p)
+			}
+		}()
+		if err = fn(tx); err == nil {
+			return tx.Commit()
+		}
+		tx.Rollback()
+	}
+	return err
+}
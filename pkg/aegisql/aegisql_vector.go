@@ -0,0 +1,301 @@
+package aegisql
+
+import (
+	"container/heap"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// Vector table layout
+	vecColID     = "id"
+	vecColVector = "vec"
+	vecColMeta   = "meta"
+	vecIDSize    = 191
+)
+
+type (
+	// Embeddings kept in a single table as little-endian float32 blobs with JSON metadata,
+	// searched by brute force, which is fine for up to a few hundred thousand vectors
+	TVectorStore struct {
+		db    TAegiSQLDB
+		table string
+		dims  int
+	}
+
+	// Vector to store; Meta is encoded as JSON, nil means no metadata
+	TVectorItem struct {
+		ID     string
+		Vector []float32
+		Meta   any
+	}
+
+	// Restricts search to some of the vectors
+	TVectorFilter struct {
+		Meta  map[string]any // top-level metadata keys that must be equal to the values, compared as JSON
+		Where TCond          // SQL condition on the table, e.g. Like("id", "chat42:%")
+	}
+
+	// Single search result
+	TVectorMatch struct {
+		ID    string
+		Score float32 // cosine similarity, 1 for the same direction
+		Meta  json.RawMessage
+	}
+
+	// Min-heap of matches by score, keeps the best k seen so far
+	tMatchHeap []TVectorMatch
+)
+
+func (h tMatchHeap) Len() int           { return len(h) }
+func (h tMatchHeap) Less(i, j int) bool { return h[i].Score < h[j].Score }
+func (h tMatchHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *tMatchHeap) Push(x any)        { *h = append(*h, x.(TVectorMatch)) }
+func (h *tMatchHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// Opens vector store kept in the table, creating the table if needed.
+// All vectors must have dims components, 0 allows any number as long as searches match it.
+func NewVectorStore(ctx context.Context, sqldb TAegiSQLDB, table string, dims int) (*TVectorStore, error) {
+	td := NewTable(table).
+		Column(vecColID, KindString, Size(vecIDSize)).
+		Column(vecColVector, KindBlob).
+		Column(vecColMeta, KindText, Nullable()).
+		Key(vecColID)
+	err := sqldb.CreateTableCtx(ctx, td)
+	if err == nil {
+		return &TVectorStore{db: sqldb, table: table, dims: dims}, nil
+	}
+	return nil, err
+}
+
+// Encodes vector as little-endian float32 values
+func EncodeVector(vec []float32) []byte {
+	blob := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(blob[4*i:], math.Float32bits(v))
+	}
+	return blob
+}
+
+// Decodes vector written by EncodeVector
+func DecodeVector(blob []byte) ([]float32, error) {
+	if len(blob)%4 != 0 {
+		return nil, fmt.Errorf("vector blob of %d bytes is not a multiple of 4", len(blob))
+	}
+	vec := make([]float32, len(blob)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+	}
+	return vec, nil
+}
+
+// Returns cosine similarity of the vectors of equal length, 0 if either is all zeros
+func CosineSimilarity(a []float32, b []float32) float32 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(normA*normB))
+}
+
+// Inserts or replaces vectors in one transaction
+func (vs *TVectorStore) Put(ctx context.Context, items ...TVectorItem) error {
+	d, err := vs.db.Dialect()
+	if err != nil {
+		return err
+	}
+	rows := make([][]any, len(items))
+	for i, item := range items {
+		if vs.dims > 0 && len(item.Vector) != vs.dims {
+			return fmt.Errorf("vector %q has %d dimensions instead of %d", item.ID, len(item.Vector), vs.dims)
+		}
+		var meta any
+		if item.Meta != nil {
+			encoded, merr := json.Marshal(item.Meta)
+			if merr != nil {
+				return fmt.Errorf("vector %q: %w", item.ID, merr)
+			}
+			meta = string(encoded)
+		}
+		rows[i] = []any{item.ID, EncodeVector(item.Vector), meta}
+	}
+	query := d.Upsert(vs.table, []string{vecColID, vecColVector, vecColMeta}, []string{vecColID})
+	return vs.db.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		stmt, perr := tx.PrepareContext(ctx, query)
+		if perr != nil {
+			return perr
+		}
+		defer stmt.Close()
+		for _, row := range rows {
+			if _, eerr := stmt.ExecContext(ctx, row...); eerr != nil {
+				return eerr
+			}
+		}
+		return nil
+	})
+}
+
+// Returns stored vector and its metadata, reports false if there is no such id
+func (vs *TVectorStore) Get(ctx context.Context, id string) ([]float32, json.RawMessage, bool, error) {
+	query, args, err := vs.db.Build(Select(vecColVector, vecColMeta).From(vs.table).Where(Eq(vecColID, id)))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var (
+		blob []byte
+		meta sql.NullString
+	)
+	ctx, cancel := vs.db.withTimeout(ctx)
+	defer cancel()
+	err = vs.db.QueryRowContext(ctx, query, args...).Scan(&blob, &meta)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, false, nil
+	}
+	if err == nil {
+		vec, derr := DecodeVector(blob)
+		return vec, rawMeta(meta), derr == nil, derr
+	}
+	return nil, nil, false, err
+}
+
+// Removes vectors, returns how many were there
+func (vs *TVectorStore) Delete(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	values := make([]any, len(ids))
+	for i := range ids {
+		values[i] = ids[i]
+	}
+	res, err := vs.db.QuerySingleBuiltCtx(ctx, Delete(vs.table).Where(In(vecColID, values...)))
+	if err == nil {
+		return res.RowsAffected()
+	}
+	return 0, err
+}
+
+func rawMeta(meta sql.NullString) json.RawMessage {
+	if meta.Valid {
+		return json.RawMessage(meta.String)
+	}
+	return nil
+}
+
+// Tells if metadata has all the wanted keys with equal values
+func metaMatches(meta json.RawMessage, want map[string]string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	var fields map[string]json.RawMessage
+	if meta == nil || json.Unmarshal(meta, &fields) != nil {
+		return false
+	}
+	for key, value := range want {
+		got, ok := fields[key]
+		if !ok {
+			return false
+		}
+		normalized, err := normalizeJSON(got)
+		if err != nil || normalized != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns JSON text in canonical form, so that e.g. 1 and 1.0 or differently spaced objects compare equal
+func normalizeJSON(raw []byte) (string, error) {
+	var value any
+	err := json.Unmarshal(raw, &value)
+	if err == nil {
+		normalized, merr := json.Marshal(value)
+		return string(normalized), merr
+	}
+	return "", err
+}
+
+// Returns up to k vectors most similar to query, best first
+func (vs *TVectorStore) Search(ctx context.Context, query []float32, k int, filter TVectorFilter) ([]TVectorMatch, error) {
+	if k <= 0 {
+		return nil, errors.New("k must be positive")
+	}
+	if vs.dims > 0 && len(query) != vs.dims {
+		return nil, fmt.Errorf("query has %d dimensions instead of %d", len(query), vs.dims)
+	}
+	want := make(map[string]string, len(filter.Meta))
+	for key, value := range filter.Meta {
+		encoded, err := json.Marshal(value)
+		if err == nil {
+			want[key], err = normalizeJSON(encoded)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("metadata filter %q: %w", key, err)
+		}
+	}
+	q := Select(vecColID, vecColVector, vecColMeta).From(vs.table)
+	if filter.Where != nil {
+		q.Where(filter.Where)
+	}
+	if len(want) > 0 {
+		q.Where(NotNull(vecColMeta))
+	}
+	rows, err := vs.db.QueryDataBuiltCtx(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	best := make(tMatchHeap, 0, k)
+	vec := make([]float32, len(query))
+	for rows.Next() {
+		var (
+			id   string
+			blob []byte
+			meta sql.NullString
+		)
+		if err = rows.Scan(&id, &blob, &meta); err != nil {
+			return nil, err
+		}
+		if len(blob) != 4*len(query) {
+			return nil, fmt.Errorf("vector %q has %d dimensions, query has %d", id, len(blob)/4, len(query))
+		}
+		// one buffer serves all rows
+		for i := range vec {
+			vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+		}
+		score := CosineSimilarity(query, vec)
+		if len(best) == k && score <= best[0].Score {
+			continue
+		}
+		if !metaMatches(rawMeta(meta), want) {
+			continue
+		}
+		match := TVectorMatch{ID: id, Score: score, Meta: rawMeta(meta)}
+		if len(best) < k {
+			heap.Push(&best, match)
+		} else {
+			best[0] = match
+			heap.Fix(&best, 0)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(best, func(i, j int) bool { return best[i].Score > best[j].Score })
+	return best, nil
+}
@@ -0,0 +1,147 @@
+package aegisqltest
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/UrsusArctos/dkit/pkg/aegisql"
+)
+
+const (
+	// Golden files live here, relative to the package under test
+	GoldenDir = "testdata"
+	// Setting this variable to 1 rewrites golden files, like -update-golden does
+	UpdateGoldenEnv = "UPDATE_GOLDEN"
+)
+
+type (
+	// What to prepare in a fresh database, in field order
+	TFixture struct {
+		Migrations    []aegisql.TMigration
+		MigrationsFS  fs.FS    // loaded with TMigrator.LoadFS
+		MigrationsDir string   // directory of migration files within MigrationsFS
+		Seed          []string // scripts of one or more statements
+		SeedFiles     []string // paths of seed scripts
+	}
+)
+
+var (
+	updateGolden = flag.Bool("update-golden", false, "rewrite golden files with actual results")
+	dbCounter    atomic.Int64
+)
+
+// Opens in-memory SQLite database seen by this test only, prepared as described by fx,
+// and closes it on test cleanup. Any failure stops the test.
+func NewDB(t testing.TB, fx TFixture) aegisql.TAegiSQLDB {
+	t.Helper()
+	// shared cache lets every pool connection see the same database, a unique name keeps tests apart
+	name := fmt.Sprintf("%s-%d", strings.NewReplacer("/", "_", " ", "_", "?", "_", "#", "_").Replace(t.Name()), dbCounter.Add(1))
+	db, err := aegisql.OpenConfig(aegisql.TSQLiteConfig{Path: name, InMemory: true, SharedCache: true, ForeignKeys: true})
+	if err != nil {
+		t.Fatalf("cannot open test database: %v", err)
+	}
+	// the database lives as long as its last connection, so one is kept open until cleanup
+	db.ConfigurePool(aegisql.DefaultPoolConfig(aegisql.DriverSQLite3))
+	t.Cleanup(func() {
+		db.Close()
+	})
+	ctx := context.Background()
+	if len(fx.Migrations) > 0 || fx.MigrationsFS != nil {
+		m, merr := aegisql.NewMigrator(db, fx.Migrations...)
+		if merr == nil && fx.MigrationsFS != nil {
+			merr = m.LoadFS(fx.MigrationsFS, fx.MigrationsDir)
+		}
+		if merr == nil {
+			merr = m.UpCtx(ctx)
+		}
+		if merr != nil {
+			t.Fatalf("cannot migrate test database: %v", merr)
+		}
+	}
+	for _, script := range fx.Seed {
+		Exec(t, db, script)
+	}
+	for _, path := range fx.SeedFiles {
+		script, rerr := os.ReadFile(path)
+		if rerr != nil {
+			t.Fatalf("cannot read seed file: %v", rerr)
+		}
+		Exec(t, db, string(script))
+	}
+	return db
+}
+
+// Runs every statement of the script, stops the test on failure
+func Exec(t testing.TB, db aegisql.TAegiSQLDB, script string) {
+	t.Helper()
+	for _, stmt := range aegisql.SplitStatements(script) {
+		if _, err := db.QuerySingle(stmt); err != nil {
+			t.Fatalf("cannot execute %q: %v", stmt, err)
+		}
+	}
+}
+
+// Tells whether golden files should be rewritten instead of compared
+func Updating() bool {
+	return *updateGolden || os.Getenv(UpdateGoldenEnv) == "1"
+}
+
+// Compares got with testdata/<name>.golden, or rewrites the file when updating
+func Golden(t testing.TB, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join(GoldenDir, name+".golden")
+	if Updating() {
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err == nil {
+			err = os.WriteFile(path, got, 0o644)
+		}
+		if err != nil {
+			t.Fatalf("cannot update golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read golden file (run with -update-golden to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("result differs from %s (run with -update-golden to accept it)\n%s", path, firstDifference(want, got))
+	}
+}
+
+// Compares result of the query, one JSON object per row, with a golden file
+func GoldenQuery(t testing.TB, db aegisql.TAegiSQLDB, name string, query string, args ...any) {
+	t.Helper()
+	var out bytes.Buffer
+	if _, err := db.ExportJSONL(context.Background(), &out, query, args...); err != nil {
+		t.Fatalf("cannot run golden query: %v", err)
+	}
+	Golden(t, name, out.Bytes())
+}
+
+// Describes the first line where the texts differ
+func firstDifference(want []byte, got []byte) string {
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+	return ""
+}
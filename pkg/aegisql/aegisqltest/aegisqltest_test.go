@@ -0,0 +1,151 @@
+package aegisqltest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/UrsusArctos/dkit/pkg/aegisql"
+)
+
+type (
+	// Records failures of a helper instead of failing the test running it
+	tRecorder struct {
+		testing.TB
+		failures []string
+	}
+)
+
+func (rec *tRecorder) Helper() {}
+
+func (rec *tRecorder) Errorf(format string, args ...any) {
+	rec.failures = append(rec.failures, fmt.Sprintf(format, args...))
+}
+
+func (rec *tRecorder) Fatalf(format string, args ...any) {
+	rec.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// Runs fn against a recorder, returns failures it reported
+func failuresOf(t *testing.T, fn func(tb testing.TB)) []string {
+	rec := &tRecorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(rec)
+	}()
+	<-done
+	return rec.failures
+}
+
+// Runs the test in a temporary directory, so that golden files go there
+func inTempDir(t *testing.T) {
+	dir := t.TempDir()
+	previous, err := os.Getwd()
+	if err == nil {
+		err = os.Chdir(dir)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(previous)
+	})
+}
+
+func countRows(t *testing.T, db aegisql.TAegiSQLDB, table string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestNewDBIsolated(t *testing.T) {
+	fx := TFixture{Seed: []string{"CREATE TABLE t (id INTEGER PRIMARY KEY)"}}
+	first, second := NewDB(t, fx), NewDB(t, fx)
+	Exec(t, first, "INSERT INTO t (id) VALUES (1); INSERT INTO t (id) VALUES (2)")
+	if n := countRows(t, second, "t"); n != 0 {
+		t.Errorf("second database sees %d rows of the first", n)
+	}
+	// same fixture in another test, which would fail on an existing table if the database were shared
+	t.Run("sub", func(t *testing.T) {
+		if n := countRows(t, NewDB(t, fx), "t"); n != 0 {
+			t.Errorf("subtest database sees %d rows", n)
+		}
+	})
+}
+
+func TestNewDBFixture(t *testing.T) {
+	seedFile := filepath.Join(t.TempDir(), "seed.sql")
+	if err := os.WriteFile(seedFile, []byte("INSERT INTO users (name) VALUES ('carol');"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db := NewDB(t, TFixture{
+		Migrations: []aegisql.TMigration{{
+			Version: 1,
+			Name:    "users",
+			Up:      aegisql.TMigrationScript{aegisql.AnyDialect: "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"},
+		}},
+		MigrationsFS: fstest.MapFS{
+			"sql/0002_roles.up.sql": {Data: []byte("ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';")},
+		},
+		MigrationsDir: "sql",
+		Seed:          []string{"INSERT INTO users (name, role) VALUES ('alice', 'admin'); INSERT INTO users (name) VALUES ('bob')"},
+		SeedFiles:     []string{seedFile},
+	})
+	m, err := aegisql.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, verr := m.CurrentVersion(); verr != nil || version != 2 {
+		t.Errorf("schema version is %d (%v), want 2", version, verr)
+	}
+	inTempDir(t)
+	os.MkdirAll(GoldenDir, 0o755)
+	want := `{"name":"alice","role":"admin"}` + "\n" + `{"name":"bob","role":"user"}` + "\n" + `{"name":"carol","role":"user"}` + "\n"
+	os.WriteFile(filepath.Join(GoldenDir, "users.golden"), []byte(want), 0o644)
+	GoldenQuery(t, db, "users", "SELECT name, role FROM users ORDER BY id")
+}
+
+func TestGolden(t *testing.T) {
+	inTempDir(t)
+	t.Setenv(UpdateGoldenEnv, "")
+	if failures := failuresOf(t, func(tb testing.TB) { Golden(tb, "missing", []byte("x")) }); len(failures) != 1 || !strings.Contains(failures[0], "-update-golden") {
+		t.Errorf("missing golden file reported as %q", failures)
+	}
+	// updating writes the file, also in subdirectories, and does not compare
+	t.Setenv(UpdateGoldenEnv, "1")
+	if failures := failuresOf(t, func(tb testing.TB) { Golden(tb, "sub/result", []byte("a\nb\n")) }); len(failures) != 0 {
+		t.Fatalf("updating failed: %q", failures)
+	}
+	if content, err := os.ReadFile(filepath.Join(GoldenDir, "sub", "result.golden")); err != nil || string(content) != "a\nb\n" {
+		t.Fatalf("golden file has %q (%v)", content, err)
+	}
+	t.Setenv(UpdateGoldenEnv, "")
+	if failures := failuresOf(t, func(tb testing.TB) { Golden(tb, "sub/result", []byte("a\nb\n")) }); len(failures) != 0 {
+		t.Errorf("equal result reported as %q", failures)
+	}
+	failures := failuresOf(t, func(tb testing.TB) { Golden(tb, "sub/result", []byte("a\nc\n")) })
+	if len(failures) != 1 || !strings.Contains(failures[0], "line 2:\n  want: b\n  got:  c") {
+		t.Errorf("different result reported as %q", failures)
+	}
+}
+
+func TestGoldenFlag(t *testing.T) {
+	inTempDir(t)
+	t.Setenv(UpdateGoldenEnv, "")
+	*updateGolden = true
+	defer func() { *updateGolden = false }()
+	db := NewDB(t, TFixture{Seed: []string{"CREATE TABLE t (n INTEGER); INSERT INTO t VALUES (1), (NULL)"}})
+	GoldenQuery(t, db, "flag", "SELECT n FROM t ORDER BY n")
+	if content, err := os.ReadFile(filepath.Join(GoldenDir, "flag.golden")); err != nil || string(content) != "{\"n\":null}\n{\"n\":1}\n" {
+		t.Errorf("golden file has %q (%v)", content, err)
+	}
+}
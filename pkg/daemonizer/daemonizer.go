@@ -6,7 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/signal"
+	"time"
 )
 
 const (
@@ -43,15 +43,26 @@ const (
 type (
 	TLinuxDaemon struct {
 		// internal
-		name    string
-		pidFile string
+		name     string
+		pidFile  string
+		notify   *os.File // pipe to the parent waiting for FuncInit, in a detached child
+		detached bool     // this is the detached child
 		// exported
 		Foreground bool
 		LogPath    string
 		ConfFile   string
+		OutputFile string // receives stdout and stderr of a detached daemon, discarded if empty
 		FuncInit   TDaemonCycle
 		FuncClose  TDaemonCycle
 		FuncMain   TDaemonCycle
+		// signal hooks, called between FuncMain cycles
+		FuncReload    TDaemonCycle // SIGHUP
+		FuncUser1     TDaemonCycle // SIGUSR1
+		FuncUser2     TDaemonCycle // SIGUSR2
+		FuncHookError func(sig os.Signal, err error)
+		// time allowed for the last FuncMain cycle and FuncClose after SIGTERM, SIGQUIT or SIGINT,
+		// defaults to 30s, negative means no limit
+		ShutdownTimeout time.Duration
 	}
 
 	TDaemonCycle func() (err error)
@@ -60,15 +71,15 @@ type (
 func NewLinuxDaemon(dname string) (ld TLinuxDaemon) {
 	ld.name = dname
 	ld.parseCmdLine()
-	ld.writePidFile()
 	ld.FuncInit = nil
 	ld.FuncClose = nil
 	ld.FuncMain = nil
 	return ld
 }
 
+// Removes the PID file and lets another instance start; Run does it by itself on return
 func (ld *TLinuxDaemon) Close() {
-	os.Remove(ld.pidFile)
+	releasePidFile()
 }
 
 func (ld *TLinuxDaemon) parseCmdLine() {
@@ -79,51 +90,58 @@ func (ld *TLinuxDaemon) parseCmdLine() {
 	flag.Parse()
 }
 
-func (ld TLinuxDaemon) writePidFile() {
-	f, err := os.Create(ld.pidFile)
-	if err == nil {
-		defer f.Close()
-		f.WriteString(fmt.Sprintf("%d", os.Getpid()))
+// Claims the PID file, fails if another live instance holds it
+func (ld TLinuxDaemon) writePidFile() error {
+	if err := lockPidFile(ld.pidFile); err != nil {
+		return fmt.Errorf("pid file %s: %w", ld.pidFile, err)
 	}
+	return nil
 }
 
 func (ld TLinuxDaemon) Run() error {
+	// unless told otherwise, leave the terminal; the parent process exits here
+	if !ld.Foreground {
+		if errDetach := ld.detach(); errDetach != nil {
+			return errDetach
+		}
+	}
+	// only one instance at a time, the lock is held until return
+	if errPid := ld.writePidFile(); errPid != nil {
+		ld.reportInit(errPid)
+		return errPid
+	}
+	defer releasePidFile()
+	// receive stop, reload and user signals, a stop during initialization skips the main loop
+	sw := ld.watchSignals()
+	defer sw.close()
 	// run initialization, if any
 	if ld.FuncInit != nil {
 		errInit := ld.FuncInit()
 		if errInit != nil {
+			ld.reportInit(errInit)
 			return errInit
 		}
 	}
-	// set this daemon to receive SIGINT
-	kill := make(chan os.Signal, 1)
-	signal.Notify(kill, os.Interrupt)
+	ld.reportInit(nil)
+	SdNotify(ld.readyState())
+	wd := startWatchdog()
 	// run main loop
-	var sigint bool = false
 	var errMain error
 	if ld.FuncMain != nil {
-		for errMain = ld.FuncMain(); (errMain == nil) && (!sigint); errMain = ld.FuncMain() {
-			// check if this cycle failed
-			// if errMain != nil {
-			// 	break
-			// }
-			// check if SIGINT is received
-			select {
-			case <-kill:
-				{
-					sigint = true
-					errMain = nil
-				}
-			default:
+		for !sw.stopping() {
+			if errMain = ld.FuncMain(); errMain != nil {
+				break
 			}
+			wd.beat()
+			// reload and user hooks run between cycles, never alongside FuncMain
+			ld.runHooks(sw)
 		}
 	} else {
 		// no main function specified, that's an error
 		errMain = fmt.Errorf("FuncMain() is not set")
 	}
-
-	// stop receiving signals
-	signal.Stop(kill)
+	wd.stop()
+	SdNotify(SdStopping)
 
 	// run finalization, if any
 	if ld.FuncClose != nil {
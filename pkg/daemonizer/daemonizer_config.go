@@ -0,0 +1,458 @@
+//go:build linux
+
+package daemonizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Struct tags understood by LoadConfig
+	tagConf     = "conf"
+	tagDefault  = "default"
+	tagEnv      = "env"
+	tagSkip     = "-"
+	optRequired = "required"
+	// Separates section and key, and nested struct keys
+	keySeparator = "."
+	// Separates items of a list value
+	listSeparator = ","
+)
+
+const (
+	// Config file formats
+	ConfigAuto TConfigFormat = iota // JSON for .json files or content starting with {, INI otherwise
+	ConfigINI                       // [section] and key = value lines, also plain key = value files
+	ConfigJSON                      // objects, nested ones become sections
+)
+
+type (
+	TConfigFormat int
+
+	TConfigOptions struct {
+		Format TConfigFormat
+		// when set, key section.name is also read from variable PREFIX_SECTION_NAME;
+		// an env tag of a field takes precedence
+		EnvPrefix string
+		// a missing file is not an error, the config then comes from defaults and environment
+		AllowMissing bool
+	}
+
+	// Value of a key, either text or a list given as [...] or a JSON array
+	tConfValue struct {
+		text   string
+		list   []string
+		isList bool
+	}
+
+	// Defines a single struct field set from the config
+	tConfField struct {
+		key      string
+		index    []int
+		def      string
+		hasDef   bool
+		env      string
+		required bool
+	}
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Reads config file, usually ConfFile of the daemon, into a new T. Fields are described by tags:
+//
+//	Listen  string        `conf:"server.listen,required"` // key, required fails loading when no source has it
+//	Timeout time.Duration `conf:"timeout" default:"5s"`   // value used when the file has no such key
+//	Token   string        `conf:"token" env:"MYD_TOKEN"`  // environment variable overriding the file
+//	Server  TServerConf   `conf:"server"`                 // nested struct, its keys go under server.
+//
+// Untagged fields use their name as the key, keys are case-insensitive. Supported are strings, bools,
+// numbers, time.Duration, []string and encoding.TextUnmarshaler implementations. Lists come as
+// ["a", "b"] or JSON arrays, environment variables and defaults separate items with commas.
+func LoadConfig[T any](path string, opts TConfigOptions) (*T, error) {
+	cfg := new(T)
+	if err := loadConfig(reflect.ValueOf(cfg).Elem(), path, opts); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Loads the config again, typically from FuncReload on SIGHUP, and returns keys whose values changed.
+// On error the current config is to be kept.
+func ReloadConfig[T any](path string, opts TConfigOptions, current *T) (*T, []string, error) {
+	fresh, err := LoadConfig[T](path, opts)
+	if err == nil {
+		return fresh, ConfigDiff(current, fresh), nil
+	}
+	return nil, nil, err
+}
+
+// Returns keys of the fields that differ between two configs, all of them if old is nil
+func ConfigDiff[T any](old, fresh *T) []string {
+	fields, err := configFields(reflect.TypeOf((*T)(nil)).Elem(), "", nil)
+	if err != nil || fresh == nil {
+		return nil
+	}
+	var changed []string
+	nv := reflect.ValueOf(fresh).Elem()
+	for _, f := range fields {
+		if old == nil || !reflect.DeepEqual(reflect.ValueOf(old).Elem().FieldByIndex(f.index).Interface(), nv.FieldByIndex(f.index).Interface()) {
+			changed = append(changed, f.key)
+		}
+	}
+	return changed
+}
+
+func loadConfig(cfg reflect.Value, path string, opts TConfigOptions) error {
+	if cfg.Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a struct, not %s", cfg.Type())
+	}
+	fields, err := configFields(cfg.Type(), "", nil)
+	if err != nil {
+		return err
+	}
+	values, err := readConfigFile(path, opts)
+	if err != nil {
+		return err
+	}
+	// report every bad key at once rather than one per restart
+	var problems []error
+	for _, f := range fields {
+		value, ok := values[f.key]
+		env := f.env
+		if env == "" && opts.EnvPrefix != "" {
+			env = opts.EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(f.key, keySeparator, "_"))
+		}
+		if env != "" {
+			if text, found := os.LookupEnv(env); found {
+				value, ok = tConfValue{text: text}, true
+			}
+		}
+		if !ok && f.hasDef {
+			value, ok = tConfValue{text: f.def}, true
+		}
+		if !ok {
+			if f.required {
+				problems = append(problems, fmt.Errorf("%s is required", f.key))
+			}
+			continue
+		}
+		if err = setConfValue(cfg.FieldByIndex(f.index), value); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", f.key, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("config %s: %w", path, errors.Join(problems...))
+	}
+	return nil
+}
+
+// Collects settable fields of a config struct, descending into nested structs
+func configFields(st reflect.Type, prefix string, index []int) ([]tConfField, error) {
+	if st.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a struct, not %s", st)
+	}
+	var fields []tConfField
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Field(i)
+		tag, tagged := field.Tag.Lookup(tagConf)
+		if !field.IsExported() || tag == tagSkip {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		fieldIndex := append(append([]int{}, index...), i)
+		if isConfSection(field.Type) {
+			// untagged embedded structs share the keys of their parent
+			sub := prefix
+			if !field.Anonymous || tagged {
+				if name == "" {
+					name = field.Name
+				}
+				sub = prefix + strings.ToLower(name) + keySeparator
+			}
+			nested, err := configFields(field.Type, sub, fieldIndex)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nested...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		f := tConfField{key: prefix + strings.ToLower(name), index: fieldIndex, env: field.Tag.Get(tagEnv)}
+		f.def, f.hasDef = field.Tag.Lookup(tagDefault)
+		for _, o := range strings.Split(options, ",") {
+			f.required = f.required || strings.TrimSpace(o) == optRequired
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// Tells whether a field holds a group of keys rather than a single value
+func isConfSection(ft reflect.Type) bool {
+	return ft.Kind() == reflect.Struct && !reflect.PointerTo(ft).Implements(textUnmarshalerType) && ft != reflect.TypeOf(time.Time{})
+}
+
+// Returns flattened section.key values of the file, keys in lower case
+func readConfigFile(path string, opts TConfigOptions) (map[string]tConfValue, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if opts.AllowMissing && errors.Is(err, os.ErrNotExist) {
+			return map[string]tConfValue{}, nil
+		}
+		return nil, err
+	}
+	format := opts.Format
+	if format == ConfigAuto {
+		// .conf files come in either format, so anything but .json is told by its first character
+		format = ConfigINI
+		if trimmed := bytes.TrimSpace(content); strings.EqualFold(filepath.Ext(path), ".json") || (len(trimmed) > 0 && trimmed[0] == '{') {
+			format = ConfigJSON
+		}
+	}
+	if format == ConfigJSON {
+		return parseJSONConfig(path, content)
+	}
+	return parseINIConfig(path, content)
+}
+
+// Parses [section] headers and key = value lines; # and ; start comments, values may be quoted.
+// A value in brackets is a list of bare or quoted items on a single line, like hosts = ["a", "b"].
+func parseINIConfig(path string, content []byte) (map[string]tConfValue, error) {
+	values := make(map[string]tConfValue)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			if section != "" {
+				section += keySeparator
+			}
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !found || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		var (
+			parsed tConfValue
+			err    error
+		)
+		if strings.HasPrefix(value, "[") {
+			parsed.list, err = parseConfList(value)
+			parsed.isList = true
+		} else {
+			parsed.text, err = unquoteConfValue(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		values[section+key] = parsed
+	}
+	return values, scanner.Err()
+}
+
+// Removes quotes of a value, or a trailing comment of an unquoted one
+func unquoteConfValue(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '"' {
+		end := strings.LastIndexByte(value, '"')
+		if end > 0 {
+			return strconv.Unquote(value[:end+1])
+		}
+	}
+	if len(value) >= 2 && value[0] == '\'' {
+		if end := strings.IndexByte(value[1:], '\''); end >= 0 {
+			return value[1 : end+1], nil
+		}
+	}
+	for _, comment := range []string{" #", " ;", "\t#", "\t;"} {
+		if at := strings.Index(value, comment); at >= 0 {
+			value = strings.TrimSpace(value[:at])
+		}
+	}
+	return value, nil
+}
+
+// Returns items of a [...] list, which may end with a comma and be followed by a comment
+func parseConfList(value string) ([]string, error) {
+	items := []string{}
+	rest := value[1:]
+	for {
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return nil, errors.New("list is not closed with ], lists must fit on one line")
+		}
+		if rest[0] == ']' {
+			if tail := strings.TrimSpace(rest[1:]); tail != "" && tail[0] != '#' && tail[0] != ';' {
+				return nil, fmt.Errorf("unexpected %q after list", tail)
+			}
+			return items, nil
+		}
+		var item string
+		switch rest[0] {
+		case '"':
+			end := 1
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(rest) {
+				return nil, errors.New("unterminated string in list")
+			}
+			unquoted, err := strconv.Unquote(rest[:end+1])
+			if err != nil {
+				return nil, err
+			}
+			item, rest = unquoted, rest[end+1:]
+		case '\'':
+			end := strings.IndexByte(rest[1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated string in list")
+			}
+			item, rest = rest[1:end+1], rest[end+2:]
+		default:
+			end := strings.IndexAny(rest, ",]")
+			if end < 0 {
+				return nil, errors.New("list is not closed with ], lists must fit on one line")
+			}
+			if item = strings.TrimSpace(rest[:end]); item == "" {
+				return nil, errors.New("empty item in list")
+			}
+			rest = rest[end:]
+		}
+		items = append(items, item)
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, ",") {
+			rest = rest[1:]
+		} else if !strings.HasPrefix(rest, "]") {
+			return nil, errors.New("list items must be separated by commas")
+		}
+	}
+}
+
+// Flattens JSON objects into section.key values
+func parseJSONConfig(path string, content []byte) (map[string]tConfValue, error) {
+	var root map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := make(map[string]tConfValue)
+	var flatten func(prefix string, object map[string]any)
+	flatten = func(prefix string, object map[string]any) {
+		for key, value := range object {
+			key = prefix + strings.ToLower(key)
+			switch v := value.(type) {
+			case map[string]any:
+				flatten(key+keySeparator, v)
+			case []any:
+				items := make([]string, 0, len(v))
+				for _, item := range v {
+					items = append(items, fmt.Sprint(item))
+				}
+				values[key] = tConfValue{list: items, isList: true}
+			case nil:
+			default:
+				values[key] = tConfValue{text: fmt.Sprint(v)}
+			}
+		}
+	}
+	flatten("", root)
+	return values, nil
+}
+
+// Converts config value to the type of the field
+func setConfValue(field reflect.Value, value tConfValue) error {
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+		items := value.list
+		if !value.isList {
+			// text from environment, defaults or a plain key = a, b line
+			for _, item := range strings.Split(value.text, listSeparator) {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		}
+		list := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			list.Index(i).SetString(item)
+		}
+		field.Set(list)
+		return nil
+	}
+	if value.isList {
+		return fmt.Errorf("list given for %s", field.Type())
+	}
+	raw := value.text
+	if field.CanAddr() && field.Addr().Type().Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err == nil {
+			field.SetInt(int64(d))
+		}
+		return err
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, intBase(raw), field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, intBase(raw), field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// Integers are decimal unless 0x, 0o or 0b is spelled out, so that a leading zero does not mean octal
+func intBase(raw string) int {
+	digits := strings.TrimLeft(raw, "+-")
+	if len(digits) >= 2 && digits[0] == '0' && strings.ContainsRune("xXoObB", rune(digits[1])) {
+		return 0
+	}
+	return 10
+}
@@ -0,0 +1,124 @@
+//go:build linux
+
+package daemonizer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type (
+	tTestServerConf struct {
+		Listen string `conf:"listen,required"`
+		Port   int    `conf:"port" default:"80"`
+	}
+
+	tTestConf struct {
+		Server  tTestServerConf `conf:"server"`
+		Hosts   []string        `conf:"hosts"`
+		Tags    []string        `conf:"tags" default:"a, b"`
+		Timeout time.Duration   `conf:"timeout" default:"5s"`
+		Token   string          `conf:"token" env:"DAEMONIZER_TEST_TOKEN"`
+	}
+)
+
+func writeTestConf(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigINI(t *testing.T) {
+	t.Setenv("DAEMONIZER_TEST_TOKEN", "secret")
+	path := writeTestConf(t, "d.conf", `hosts = ["a, b", 'c', d ,] # three hosts
+timeout = 1m
+[server]
+listen = "0.0.0.0" ; any
+`)
+	cfg, err := LoadConfig[tTestConf](path, TConfigOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := tTestConf{
+		Server:  tTestServerConf{Listen: "0.0.0.0", Port: 80},
+		Hosts:   []string{"a, b", "c", "d"},
+		Tags:    []string{"a", "b"},
+		Timeout: time.Minute,
+		Token:   "secret",
+	}
+	if !reflect.DeepEqual(*cfg, want) {
+		t.Errorf("want %+v, got %+v", want, *cfg)
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := writeTestConf(t, "d.json", `{"server": {"listen": "::1", "port": 8080}, "hosts": ["x,y", "z"]}`)
+	cfg, err := LoadConfig[tTestConf](path, TConfigOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 8080 || !reflect.DeepEqual(cfg.Hosts, []string{"x,y", "z"}) {
+		t.Errorf("unexpected config %+v", *cfg)
+	}
+}
+
+func TestLoadConfigIntegers(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want int
+	}{
+		{"0800", 800},
+		{"-010", -10},
+		{"0x1F", 31},
+		{"0o17", 15},
+		{"0b101", 5},
+	} {
+		cfg, err := LoadConfig[tTestConf](writeTestConf(t, "d.conf", "[server]\nlisten = x\nport = "+tc.raw), TConfigOptions{})
+		if err != nil || cfg.Server.Port != tc.want {
+			t.Errorf("port = %s: want %d, got %+v, %v", tc.raw, tc.want, cfg, err)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		content string
+		want    string
+	}{
+		{"[server]\nlisten = x\nport = [1, 2]", "server.port: list given for int"},
+		{"[server]\nlisten = x\n\nhosts = [\"a\",\n  \"b\"]", ":4: list is not closed"},
+		{"hosts = [\"a\" \"b\"]", ":1: list items must be separated by commas"},
+		{"hosts = [a] b", ":1: unexpected \"b\" after list"},
+		{"hosts = [\"a]", ":1: unterminated string in list"},
+		{"timeout = 1m", "server.listen is required"},
+		{"junk", ":1: expected key = value"},
+	} {
+		_, err := LoadConfig[tTestConf](writeTestConf(t, "d.conf", tc.content), TConfigOptions{})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: want error containing %q, got %v", tc.content, tc.want, err)
+		}
+	}
+}
+
+func TestReloadConfigDiff(t *testing.T) {
+	path := writeTestConf(t, "d.conf", "[server]\nlisten = a\n")
+	cfg, err := LoadConfig[tTestConf](path, TConfigOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, changed, err := ReloadConfig(path, TConfigOptions{}, cfg)
+	if err != nil || len(changed) != 0 || !reflect.DeepEqual(fresh, cfg) {
+		t.Errorf("unchanged file reported %v, %v", changed, err)
+	}
+	os.WriteFile(path, []byte("hosts = [h]\n[server]\nlisten = b\n"), 0o644)
+	if _, changed, err = ReloadConfig(path, TConfigOptions{}, cfg); err != nil || !reflect.DeepEqual(changed, []string{"server.listen", "hosts"}) {
+		t.Errorf("want [server.listen hosts], got %v, %v", changed, err)
+	}
+}
@@ -0,0 +1,162 @@
+//go:build linux
+
+package daemonizer
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// Tells the re-executed child which descriptor leads back to the waiting parent
+	envNotifyFD = "DAEMONIZER_NOTIFY_FD"
+	// First descriptor after stdio, where exec.Cmd puts ExtraFiles[0]
+	childNotifyFD = 3
+	// Message the child sends once FuncInit succeeds
+	initOK = "ok"
+	// File mode creation mask of the daemon
+	daemonUmask = 0o027
+	// Null device
+	devNull = "/dev/null"
+)
+
+// Tells whether this process is the detached child of a daemon that was started in background
+func isDetachedChild() bool {
+	return os.Getenv(envNotifyFD) != ""
+}
+
+// Turns the process into a daemon: the parent re-executes itself in a new session and exits
+// once the child reports the outcome of FuncInit, while the child just settles down and returns
+func (ld *TLinuxDaemon) detach() error {
+	if isDetachedChild() {
+		fd, err := strconv.Atoi(os.Getenv(envNotifyFD))
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", envNotifyFD, err)
+		}
+		os.Unsetenv(envNotifyFD)
+		ld.detached = true
+		ld.notify = os.NewFile(uintptr(fd), "daemonizer-notify")
+		syscall.Umask(daemonUmask)
+		return os.Chdir("/")
+	}
+	os.Exit(ld.spawn())
+	return nil
+}
+
+// Starts the detached child and waits for its report, returns exit status for the parent
+func (ld *TLinuxDaemon) spawn() int {
+	// refuse early, while the error can still reach the terminal directly
+	if pid, running, err := ReadPidFile(ld.pidFile); err == nil && running {
+		return ld.fail(fmt.Errorf("%w with pid %d", ErrAlreadyRunning, pid))
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return ld.fail(err)
+	}
+	args, err := ld.childArgs()
+	if err != nil {
+		return ld.fail(err)
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return ld.fail(err)
+	}
+	defer reader.Close()
+	null, err := os.OpenFile(devNull, os.O_RDWR, 0)
+	if err != nil {
+		writer.Close()
+		return ld.fail(err)
+	}
+	defer null.Close()
+	output := null
+	if ld.OutputFile != "" {
+		if output, err = os.OpenFile(ld.OutputFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640); err != nil {
+			writer.Close()
+			return ld.fail(err)
+		}
+		defer output.Close()
+	}
+	cmd := exec.Command(self, args...)
+	cmd.Dir = "/"
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", envNotifyFD, childNotifyFD))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = null, output, output
+	cmd.ExtraFiles = []*os.File{writer}
+	// a new session has no controlling terminal, so closing ours no longer affects the daemon
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	writer.Close()
+	if err != nil {
+		return ld.fail(err)
+	}
+	// the child closes its end after FuncInit, or by exiting
+	report, _ := io.ReadAll(reader)
+	if string(report) == initOK {
+		return 0
+	}
+	if len(report) > 0 {
+		fmt.Fprintf(os.Stderr, "%s: initialization failed: %s\n", ld.name, report)
+	}
+	werr := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(werr, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	if len(report) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: daemon exited before initialization\n", ld.name)
+	}
+	return 1
+}
+
+func (ld *TLinuxDaemon) fail(err error) int {
+	fmt.Fprintf(os.Stderr, "%s: cannot start daemon: %v\n", ld.name, err)
+	return 1
+}
+
+// Returns command line for the child with paths made absolute, as the child runs in /
+func (ld *TLinuxDaemon) childArgs() ([]string, error) {
+	// flags are only parsed up to the first positional argument or "--"
+	parsed := os.Args[1 : len(os.Args)-flag.NArg()]
+	rest := flag.Args()
+	if len(parsed) > 0 && parsed[len(parsed)-1] == "--" {
+		parsed, rest = parsed[:len(parsed)-1], append([]string{"--"}, rest...)
+	}
+	args := append([]string{}, parsed...)
+	for _, opt := range []struct {
+		name  string
+		value string
+	}{{optConf, ld.ConfFile}, {optPID, ld.pidFile}, {optLog, ld.LogPath}} {
+		abs, err := filepath.Abs(opt.value)
+		if err != nil {
+			return nil, err
+		}
+		// log path is a prefix for file names, so it keeps its trailing slash
+		if strings.HasSuffix(opt.value, "/") && !strings.HasSuffix(abs, "/") {
+			abs += "/"
+		}
+		// flags given later take precedence
+		args = append(args, fmt.Sprintf("-%s=%s", opt.name, abs))
+	}
+	return append(args, rest...), nil
+}
+
+// Lets the waiting parent exit, with success if err is nil
+func (ld *TLinuxDaemon) reportInit(err error) {
+	if ld.notify == nil {
+		return
+	}
+	if err == nil {
+		ld.notify.WriteString(initOK)
+	} else {
+		ld.notify.WriteString(err.Error())
+	}
+	ld.notify.Close()
+	ld.notify = nil
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package daemonizer
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type (
+	// Stands in for systemd when testing notifications: listens on a datagram socket
+	// and points NOTIFY_SOCKET of the process at it
+	TFakeNotifySocket struct {
+		Path     string
+		conn     *net.UnixConn
+		previous string
+		restore  bool
+	}
+)
+
+// Creates socket in dir and sets NOTIFY_SOCKET to it until Close
+func NewFakeNotifySocket(dir string) (*TFakeNotifySocket, error) {
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err == nil {
+		fake := &TFakeNotifySocket{Path: path, conn: conn}
+		fake.previous, fake.restore = os.LookupEnv(envNotifySocket)
+		os.Setenv(envNotifySocket, path)
+		return fake, nil
+	}
+	return nil, err
+}
+
+// Returns the next notification, waiting up to timeout for it
+func (fake *TFakeNotifySocket) Next(timeout time.Duration) (string, error) {
+	buf := make([]byte, 4096)
+	fake.conn.SetReadDeadline(time.Now().Add(timeout))
+	n, err := fake.conn.Read(buf)
+	if err == nil {
+		return string(buf[:n]), nil
+	}
+	return "", err
+}
+
+// Closes the socket and restores NOTIFY_SOCKET
+func (fake *TFakeNotifySocket) Close() error {
+	if fake.restore {
+		os.Setenv(envNotifySocket, fake.previous)
+	} else {
+		os.Unsetenv(envNotifySocket)
+	}
+	err := fake.conn.Close()
+	os.Remove(fake.Path)
+	return err
+}
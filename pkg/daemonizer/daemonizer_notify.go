@@ -0,0 +1,127 @@
+//go:build linux
+
+package daemonizer
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// Environment set by systemd for Type=notify units
+	envNotifySocket = "NOTIFY_SOCKET"
+	envWatchdogUSec = "WATCHDOG_USEC"
+	envWatchdogPID  = "WATCHDOG_PID"
+	// Notification states
+	SdReady     = "READY=1"
+	SdStopping  = "STOPPING=1"
+	SdReloading = "RELOADING=1"
+	SdWatchdog  = "WATCHDOG=1"
+)
+
+type (
+	// Pings systemd watchdog as long as the main loop keeps finishing cycles
+	tWatchdog struct {
+		interval time.Duration
+		lastBeat atomic.Int64 // unix nanoseconds of the last finished cycle
+		done     chan struct{}
+	}
+)
+
+// Sends state to the service manager over NOTIFY_SOCKET, several states are separated by newlines.
+// Reports false when not started by systemd with notifications enabled.
+func SdNotify(state string) (bool, error) {
+	socket := os.Getenv(envNotifySocket)
+	if socket == "" {
+		return false, nil
+	}
+	// a leading @ means abstract socket, which net handles by itself
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err == nil {
+		defer conn.Close()
+		_, err = conn.Write([]byte(state))
+		return err == nil, err
+	}
+	return false, err
+}
+
+// Shows free-form status text in systemctl status
+func (ld TLinuxDaemon) NotifyStatus(status string) error {
+	_, err := SdNotify("STATUS=" + status)
+	return err
+}
+
+// Returns READY state, with MAINPID when the process is not the one systemd started
+func (ld TLinuxDaemon) readyState() string {
+	if ld.detached {
+		return fmt.Sprintf("%s\nMAINPID=%d", SdReady, os.Getpid())
+	}
+	return SdReady
+}
+
+// Returns RELOADING state with the timestamp systemd 253+ expects from notify-reload units
+func reloadingState() string {
+	var ts syscall.Timespec
+	const clockMonotonic = 1
+	if _, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clockMonotonic, uintptr(unsafe.Pointer(&ts)), 0); errno != 0 {
+		return SdReloading
+	}
+	return fmt.Sprintf("%s\nMONOTONIC_USEC=%d", SdReloading, ts.Nano()/int64(time.Microsecond))
+}
+
+// Returns watchdog interval requested by systemd for this process, zero if none
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv(envWatchdogUSec), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv(envWatchdogPID); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Starts pinging the watchdog at half its interval, nil if there is no watchdog.
+// A ping is skipped once no cycle has finished for a whole interval, so that systemd restarts a hung daemon.
+func startWatchdog() *tWatchdog {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return nil
+	}
+	wd := &tWatchdog{interval: interval, done: make(chan struct{})}
+	wd.beat()
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-wd.done:
+				return
+			case <-ticker.C:
+				if time.Since(time.Unix(0, wd.lastBeat.Load())) < wd.interval {
+					SdNotify(SdWatchdog)
+				}
+			}
+		}
+	}()
+	return wd
+}
+
+// Tells the watchdog the main loop is alive
+func (wd *tWatchdog) beat() {
+	if wd != nil {
+		wd.lastBeat.Store(time.Now().UnixNano())
+	}
+}
+
+func (wd *tWatchdog) stop() {
+	if wd != nil {
+		close(wd.done)
+	}
+}
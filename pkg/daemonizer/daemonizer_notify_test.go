@@ -0,0 +1,95 @@
+//go:build linux
+
+package daemonizer
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunNotifications(t *testing.T) {
+	fake, err := NewFakeNotifySocket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	t.Setenv(envWatchdogUSec, "200000")
+	t.Setenv(envWatchdogPID, "")
+	cycles := 0
+	ld := TLinuxDaemon{name: "notifytest", pidFile: filepath.Join(t.TempDir(), "notifytest.pid"), Foreground: true}
+	ld.FuncReload = func() error { return nil }
+	ld.FuncMain = func() error {
+		cycles++
+		switch cycles {
+		case 1:
+			syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+		case 6:
+			syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+		}
+		// long enough for the signal to arrive before the cycle ends, and for the watchdog to tick
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+	if err = ld.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var states []string
+	for {
+		state, nerr := fake.Next(100 * time.Millisecond)
+		if nerr != nil {
+			break
+		}
+		states = append(states, state)
+	}
+	// watchdog pings come at their own pace, the rest is in a fixed order
+	var sequence []string
+	pings := 0
+	for _, state := range states {
+		if state == SdWatchdog {
+			pings++
+			continue
+		}
+		if strings.HasPrefix(state, SdReloading+"\nMONOTONIC_USEC=") {
+			state = SdReloading
+		}
+		sequence = append(sequence, state)
+	}
+	if want := []string{SdReady, SdReloading, SdReady, SdStopping}; strings.Join(sequence, "|") != strings.Join(want, "|") {
+		t.Errorf("want %q, got %q", want, states)
+	}
+	if pings == 0 {
+		t.Errorf("no watchdog pings in %q", states)
+	}
+}
+
+func TestWatchdogSkipsHungLoop(t *testing.T) {
+	fake, err := NewFakeNotifySocket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	t.Setenv(envWatchdogUSec, "100000")
+	t.Setenv(envWatchdogPID, "")
+	wd := startWatchdog()
+	defer wd.stop()
+	if state, nerr := fake.Next(200 * time.Millisecond); nerr != nil || state != SdWatchdog {
+		t.Fatalf("want %q, got %q (%v)", SdWatchdog, state, nerr)
+	}
+	// no beat for longer than the interval, as if FuncMain hung
+	time.Sleep(150 * time.Millisecond)
+	for {
+		if _, nerr := fake.Next(10 * time.Millisecond); nerr != nil {
+			break
+		}
+	}
+	if state, nerr := fake.Next(200 * time.Millisecond); nerr == nil {
+		t.Errorf("watchdog pinged %q while the loop was hung", state)
+	}
+	wd.beat()
+	if state, nerr := fake.Next(200 * time.Millisecond); nerr != nil || state != SdWatchdog {
+		t.Errorf("want %q after a beat, got %q (%v)", SdWatchdog, state, nerr)
+	}
+}
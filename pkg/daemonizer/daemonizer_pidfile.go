@@ -0,0 +1,149 @@
+//go:build linux
+
+package daemonizer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Attempts to lock a PID file that keeps being replaced
+	maxPidLockAttempts = 3
+	// How often Stop checks whether the daemon is gone
+	stopPollInterval = 100 * time.Millisecond
+)
+
+var (
+	ErrAlreadyRunning = errors.New("daemon is already running")
+	ErrNotRunning     = errors.New("daemon is not running")
+	// PID file locked by this process, one daemon per process
+	heldPid struct {
+		mu   sync.Mutex
+		file *os.File
+		path string
+	}
+)
+
+// Creates PID file holding an exclusive lock for the life of the process. A file left by a dead
+// instance is not locked by anyone and is simply taken over; a locked one means a live instance.
+func lockPidFile(path string) error {
+	heldPid.mu.Lock()
+	defer heldPid.mu.Unlock()
+	if heldPid.file != nil {
+		return nil
+	}
+	for attempt := 0; attempt < maxPidLockAttempts; attempt++ {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				if pid, perr := readPid(path); perr == nil {
+					return fmt.Errorf("%w with pid %d", ErrAlreadyRunning, pid)
+				}
+				return ErrAlreadyRunning
+			}
+			return err
+		}
+		// the previous owner may have removed the file between our open and lock
+		locked, serr := f.Stat()
+		current, cerr := os.Stat(path)
+		if serr != nil || cerr != nil || !os.SameFile(locked, current) {
+			f.Close()
+			continue
+		}
+		if err = f.Truncate(0); err == nil {
+			if _, err = f.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0); err == nil {
+				err = f.Sync()
+			}
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+		heldPid.file, heldPid.path = f, path
+		return nil
+	}
+	return fmt.Errorf("pid file %s keeps changing", path)
+}
+
+// Removes PID file locked by this process, if any, then drops the lock
+func releasePidFile() {
+	heldPid.mu.Lock()
+	defer heldPid.mu.Unlock()
+	if heldPid.file != nil {
+		os.Remove(heldPid.path)
+		heldPid.file.Close()
+		heldPid.file, heldPid.path = nil, ""
+	}
+}
+
+func readPid(path string) (int, error) {
+	content, err := os.ReadFile(path)
+	if err == nil {
+		pid, perr := strconv.Atoi(strings.TrimSpace(string(content)))
+		if perr != nil {
+			return 0, fmt.Errorf("invalid pid file %s", path)
+		}
+		return pid, nil
+	}
+	return 0, err
+}
+
+// Returns PID written in the file and whether the instance holding it is alive
+func ReadPidFile(path string) (int, bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	pid, err := readPid(path)
+	// a live instance keeps the file locked, so a free lock means a stale file
+	if lerr := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); lerr == nil {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		return pid, false, nil
+	} else if !errors.Is(lerr, syscall.EWOULDBLOCK) {
+		return pid, false, lerr
+	}
+	return pid, true, err
+}
+
+// Returns PID of the running instance of this daemon, or ErrNotRunning
+func (ld TLinuxDaemon) Status() (int, error) {
+	pid, running, err := ReadPidFile(ld.pidFile)
+	if err == nil && !running {
+		return pid, ErrNotRunning
+	}
+	return pid, err
+}
+
+// Asks the running instance to stop gracefully and waits up to timeout for it to exit
+func (ld TLinuxDaemon) Stop(timeout time.Duration) error {
+	pid, err := ld.Status()
+	if err != nil {
+		return err
+	}
+	if err = syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(stopPollInterval)
+		if _, err = ld.Status(); errors.Is(err, ErrNotRunning) {
+			return nil
+		}
+	}
+	return fmt.Errorf("daemon with pid %d did not stop within %s", pid, timeout)
+}
@@ -0,0 +1,142 @@
+//go:build linux
+
+package daemonizer
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// How long a graceful stop may take when ShutdownTimeout is not set
+	defShutdownTimeout = 30 * time.Second
+	// Exit status of a daemon killed by the shutdown deadline or a repeated stop signal
+	exitForced = 1
+	// Hook signals waiting for the main loop, more of them are dropped
+	maxPendingSignals = 8
+)
+
+type (
+	// Watches signals while the main loop runs
+	tSignalWatch struct {
+		signals chan os.Signal
+		stop    chan struct{} // closed on the first stop signal
+		hooks   chan os.Signal
+		done    chan struct{}
+		exited  chan struct{}
+	}
+)
+
+// Signals asking the daemon to finish
+func isStopSignal(sig os.Signal) bool {
+	return sig == os.Interrupt || sig == syscall.SIGTERM || sig == syscall.SIGQUIT
+}
+
+func (ld TLinuxDaemon) shutdownTimeout() time.Duration {
+	if ld.ShutdownTimeout == 0 {
+		return defShutdownTimeout
+	}
+	return ld.ShutdownTimeout
+}
+
+// Starts watching signals. The first stop signal closes stop and arms the shutdown deadline,
+// the second one exits at once; other signals are passed to hooks.
+func (ld TLinuxDaemon) watchSignals() *tSignalWatch {
+	sw := &tSignalWatch{
+		signals: make(chan os.Signal, 1),
+		stop:    make(chan struct{}),
+		hooks:   make(chan os.Signal, maxPendingSignals),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	signal.Notify(sw.signals, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		var deadline *time.Timer
+		defer func() {
+			if deadline != nil {
+				deadline.Stop()
+			}
+			close(sw.exited)
+		}()
+		for {
+			select {
+			case <-sw.done:
+				return
+			case sig := <-sw.signals:
+				if !isStopSignal(sig) {
+					select {
+					case sw.hooks <- sig:
+					default:
+					}
+					continue
+				}
+				select {
+				case <-sw.stop:
+					fmt.Fprintf(os.Stderr, "%s: %s received again, exiting now\n", ld.name, sig)
+					os.Exit(exitForced)
+				default:
+				}
+				close(sw.stop)
+				if timeout := ld.shutdownTimeout(); timeout > 0 {
+					deadline = time.AfterFunc(timeout, func() {
+						fmt.Fprintf(os.Stderr, "%s: shutdown took longer than %s, exiting now\n", ld.name, timeout)
+						os.Exit(exitForced)
+					})
+				}
+			}
+		}
+	}()
+	return sw
+}
+
+// Stops watching signals and disarms the shutdown deadline
+func (sw *tSignalWatch) close() {
+	signal.Stop(sw.signals)
+	close(sw.done)
+	<-sw.exited
+}
+
+func (sw *tSignalWatch) stopping() bool {
+	select {
+	case <-sw.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Runs hooks of signals received so far
+func (ld TLinuxDaemon) runHooks(sw *tSignalWatch) {
+	for {
+		select {
+		case sig := <-sw.hooks:
+			var hook TDaemonCycle
+			switch sig {
+			case syscall.SIGHUP:
+				hook = ld.FuncReload
+			case syscall.SIGUSR1:
+				hook = ld.FuncUser1
+			case syscall.SIGUSR2:
+				hook = ld.FuncUser2
+			}
+			if hook == nil {
+				continue
+			}
+			if sig == syscall.SIGHUP {
+				SdNotify(reloadingState())
+			}
+			// a failed hook does not stop the daemon
+			if err := hook(); err != nil && ld.FuncHookError != nil {
+				ld.FuncHookError(sig, err)
+			}
+			if sig == syscall.SIGHUP {
+				SdNotify(SdReady)
+			}
+		default:
+			return
+		}
+	}
+}